@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/maintenance"
+)
+
+// Nagios plugin exit codes
+const (
+	nagiosOk       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+var nagiosStates = map[int]string{
+	nagiosOk:       "OK",
+	nagiosWarning:  "WARNING",
+	nagiosCritical: "CRITICAL",
+	nagiosUnknown:  "UNKNOWN",
+}
+
+// units of measurement recognized in Nagios performance data
+var nagiosUnits = map[string]bool{
+	"s": true, "ms": true, "us": true, "%": true, "B": true, "KB": true, "MB": true, "TB": true, "c": true,
+}
+
+// check runs all checks once, prints the result in the Nagios plugin output
+// format and returns the Nagios plugin exit code. Failing results of components
+// in maintenance are downgraded.
+func check(hc *healthcheck.HealthChecker, m *maintenance.Maintenance) int {
+	health := healthcheck.Aggregate(api.Health{}, healthcheck.Filtered(hc.RunChecks, m.Apply))
+	_ = hc.Close()
+	output, code := nagiosOutput(health)
+	fmt.Print(output)
+	return code
+}
+
+// checkError prints an error that prevented the checks from running in the
+// Nagios plugin output format and returns the Nagios plugin exit code unknown.
+func checkError(err error) int {
+	fmt.Printf("HEALTH %s - %v\n", nagiosStates[nagiosUnknown], err)
+	return nagiosUnknown
+}
+
+func nagiosExitCode(status api.Status) int {
+	switch status {
+	case api.StatusHealthy:
+		return nagiosOk
+	case api.StatusWarn:
+		return nagiosWarning
+	case api.StatusUnhealthy:
+		return nagiosCritical
+	default:
+		return nagiosUnknown
+	}
+}
+
+// nagiosLabel quotes label for use in performance data if it contains spaces,
+// equals signs or quotes. Quotes are escaped by doubling them.
+func nagiosLabel(label string) string {
+	if !strings.ContainsAny(label, " ='") {
+		return label
+	}
+	return "'" + strings.ReplaceAll(label, "'", "''") + "'"
+}
+
+// nagiosOutput formats health as Nagios plugin output, i.e. a status line with
+// performance data followed by one line per check that is not up.
+func nagiosOutput(health *api.Health) (string, int) {
+	code := nagiosExitCode(health.Status)
+	if len(health.Checks) == 0 {
+		code = nagiosUnknown
+	}
+
+	var names []string
+	for name := range health.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var notUp []string
+	var details []string
+	var perfData []string
+	for _, name := range names {
+		up := true
+		for _, check := range health.Checks[name] {
+			label := name
+			if check.ComponentId != "" {
+				label += ":" + check.ComponentId
+			}
+			if check.Status == api.StatusWarn || check.Status == api.StatusUnhealthy {
+				up = false
+				detail := label + " is " + string(check.Status)
+				if check.Output != "" {
+					detail += ": " + check.Output
+				}
+				details = append(details, detail)
+			}
+			if value, ok := healthcheck.NumericValue(check.ObservedValue); ok {
+				unit := ""
+				if nagiosUnits[check.ObservedUnit] {
+					unit = check.ObservedUnit
+				}
+				perfData = append(perfData, nagiosLabel(label)+"="+strconv.FormatFloat(value, 'f', -1, 64)+unit)
+			}
+		}
+		if !up {
+			notUp = append(notUp, name)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("HEALTH " + nagiosStates[code] + " - ")
+	if len(notUp) == 0 {
+		fmt.Fprintf(&sb, "%d components checked", len(names))
+	} else {
+		fmt.Fprintf(&sb, "%d of %d components not up: %s", len(notUp), len(names), strings.Join(notUp, ", "))
+	}
+	if len(perfData) > 0 {
+		sb.WriteString(" | " + strings.Join(perfData, " "))
+	}
+	sb.WriteString("\n")
+	for _, detail := range details {
+		sb.WriteString(detail + "\n")
+	}
+	return sb.String(), code
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+)
+
+func TestNagiosLabel(t *testing.T) {
+	tests := map[string]string{
+		"veidemann:jobs":      "veidemann:jobs",
+		"queue depth":         "'queue depth'",
+		"a=b":                 "'a=b'",
+		"crawler's queue":     "'crawler''s queue'",
+		"newscrawl/veidemann": "newscrawl/veidemann",
+	}
+	for label, want := range tests {
+		if got := nagiosLabel(label); got != want {
+			t.Errorf("expected %s to be %s, got %s", label, want, got)
+		}
+	}
+}
+
+func TestNagiosOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		health *api.Health
+		code   int
+		output string
+	}{
+		{
+			name: "ok",
+			health: &api.Health{Status: api.StatusHealthy, Checks: api.Checks{
+				"veidemann:dashboard": {{Status: api.StatusHealthy}},
+				"veidemann:jobs":      {{Status: api.StatusHealthy, ObservedValue: 3}},
+			}},
+			code:   nagiosOk,
+			output: "HEALTH OK - 2 components checked | veidemann:jobs=3\n",
+		},
+		{
+			name: "warning",
+			health: &api.Health{Status: api.StatusWarn, Checks: api.Checks{
+				"veidemann:crawllog": {{Status: api.StatusWarn, ObservedValue: 0.25, ObservedUnit: "%", Output: "too many errors"}},
+				"veidemann:jobs":     {{Status: api.StatusHealthy}},
+			}},
+			code:   nagiosWarning,
+			output: "HEALTH WARNING - 1 of 2 components not up: veidemann:crawllog | veidemann:crawllog=0.25%\nveidemann:crawllog is warn: too many errors\n",
+		},
+		{
+			name: "critical",
+			health: &api.Health{Status: api.StatusUnhealthy, Checks: api.Checks{
+				"veidemann:jobs":     {{Status: api.StatusWarn}},
+				"veidemann:frontier": {{Status: api.StatusUnhealthy, ComponentId: "queue depth", ObservedValue: int64(12), ObservedUnit: "urls"}},
+			}},
+			code: nagiosCritical,
+			// units that Nagios does not recognize are left out
+			output: "HEALTH CRITICAL - 2 of 2 components not up: veidemann:frontier, veidemann:jobs | 'veidemann:frontier:queue depth'=12\n" +
+				"veidemann:frontier:queue depth is down\n" +
+				"veidemann:jobs is warn\n",
+		},
+		{
+			name: "unknown status",
+			health: &api.Health{Checks: api.Checks{
+				"veidemann:jobs": {{}},
+			}},
+			code:   nagiosUnknown,
+			output: "HEALTH UNKNOWN - 1 components checked\n",
+		},
+		{
+			name:   "no checks",
+			health: &api.Health{Status: api.StatusHealthy},
+			code:   nagiosUnknown,
+			output: "HEALTH UNKNOWN - 0 components checked\n",
+		},
+		{
+			name: "booleans and durations",
+			health: &api.Health{Status: api.StatusHealthy, Checks: api.Checks{
+				"veidemann:crawler": {{Status: api.StatusHealthy, ObservedValue: true}},
+				"veidemann:latency": {{Status: api.StatusHealthy, ObservedValue: 1.5, ObservedUnit: "s"}},
+				"veidemann:version": {{Status: api.StatusHealthy, ObservedValue: "1.0.0"}},
+			}},
+			code:   nagiosOk,
+			output: "HEALTH OK - 3 components checked | veidemann:crawler=1 veidemann:latency=1.5s\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, code := nagiosOutput(test.health)
+			if code != test.code {
+				t.Errorf("expected exit code %d, got %d", test.code, code)
+			}
+			if output != test.output {
+				t.Errorf("expected output\n%s\ngot\n%s", test.output, output)
+			}
+		})
+	}
+}
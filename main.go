@@ -1,24 +1,36 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/nlnwa/veidemann-health-check-api/pkg/version"
 	flag "github.com/spf13/pflag"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
 	"github.com/nlnwa/veidemann-health-check-api/pkg/client/controller"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/grpc"
 	"github.com/nlnwa/veidemann-health-check-api/pkg/client/prometheus"
 	"github.com/nlnwa/veidemann-health-check-api/pkg/client/web"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/events"
 	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/history"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/maintenance"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/metrics"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/slo"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/webhook"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 )
 
@@ -29,61 +41,84 @@ func setDefaultHeaders(w http.ResponseWriter) {
 	w.Header().Set("Vary", "Accept-Encoding")
 }
 
-func healthCollector(health *api.Health) func(*healthcheck.CheckResult) {
-	health.Checks = make(map[string][]api.Check, 0)
-
-	return func(healthCheck *healthcheck.CheckResult) {
-		var checks []api.Check
-		for _, checkResult := range healthCheck.Results {
-			check := api.Check{
-				Time:              api.GetCurrentTime(),
-				ComponentType:     checkResult.Type,
-				ComponentId:       checkResult.Id,
-				Status:            statusToApi(checkResult.Status),
-				ObservedUnit:      checkResult.Unit,
-				ObservedValue:     checkResult.Value,
-				AffectedEndpoints: checkResult.Endpoints,
-				Links:             checkResult.Links,
-				Description:       checkResult.Description,
-				Output: func(err error) string {
-					if err != nil {
-						return err.Error()
-					}
-					return ""
-				}(checkResult.Err),
-			}
-			checks = append(checks, check)
-			if check.Status.Value() > 0 && check.Status.Value() < health.Status.Value() {
-				health.Status = check.Status
-			}
+// statusCode returns the HTTP status code of a response with the given health status.
+//
+// The query parameter "force200" makes the status code 200 regardless of the health
+// status, which is useful for dashboards that don't handle other status codes.
+func statusCode(r *http.Request, status api.Status, warnStatusCode int) int {
+	if force, ok := r.URL.Query()["force200"]; ok {
+		if force[0] == "" {
+			return http.StatusOK
 		}
-		health.Checks[healthCheck.Name] = checks
+		if b, err := strconv.ParseBool(force[0]); err == nil && b {
+			return http.StatusOK
+		}
+	}
+	switch status {
+	case api.StatusUnhealthy:
+		return http.StatusServiceUnavailable
+	case api.StatusWarn:
+		return warnStatusCode
+	default:
+		return http.StatusOK
 	}
 }
 
-func statusToApi(status healthcheck.Status) api.Status {
-	statusToApi := map[healthcheck.Status]api.Status{
-		healthcheck.StatusPass:    api.StatusHealthy,
-		healthcheck.StatusWarning: api.StatusWarn,
-		healthcheck.StatusFail:    api.StatusUnhealthy,
+func healthCheckHandler(scheduler *healthcheck.Scheduler, base api.Health, warnStatusCode int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health := healthcheck.Aggregate(base, scheduler.Snapshot)
+		writeHealth(w, r, health, warnStatusCode)
 	}
-	return statusToApi[status]
 }
 
-func healthCheckHandler(hc *healthcheck.HealthChecker, health *api.Health) http.HandlerFunc {
-	return func(w http.ResponseWriter, _ *http.Request) {
-		setDefaultHeaders(w)
+// componentHealthCheckHandler responds with the health of the component or
+// target with the id or name given by the rest of the request path, or with
+// the health of all components if the rest of the path is empty.
+func componentHealthCheckHandler(scheduler *healthcheck.Scheduler, base api.Health, warnStatusCode int, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, prefix)
+		if id == "" {
+			writeHealth(w, r, healthcheck.Aggregate(base, scheduler.Snapshot), warnStatusCode)
+			return
+		}
+		snapshot, ok := scheduler.ComponentSnapshot(id)
+		if !ok {
+			snapshot, ok = scheduler.TargetSnapshot(strings.TrimSuffix(id, "/"))
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		health := healthcheck.Aggregate(base, snapshot)
+		writeHealth(w, r, health, warnStatusCode)
+	}
+}
 
-		health.Status = api.StatusHealthy
+// writeHealth writes health in the media type preferred by the Accept header of
+// the request, i.e. JSON, an HTML status page or a plain text summary.
+func writeHealth(w http.ResponseWriter, r *http.Request, health *api.Health, warnStatusCode int) {
+	setDefaultHeaders(w)
 
-		hc.RunChecks(healthCollector(health))
+	mediaType := negotiate(r.Header.Get("Accept"))
+	if mediaType != mediaTypeHealthJson {
+		w.Header().Set("Content-Type", mediaType+"; charset=UTF-8")
+	}
+	w.Header().Set("Vary", "Accept, Accept-Encoding")
 
-		writer := io.MultiWriter(w, log.Writer())
+	// render before the header is written, so an error can still be reported
+	var buf bytes.Buffer
+	if err := render(&buf, mediaType, health); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
 
-		if err := json.NewEncoder(writer).Encode(health); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			log.Println(err)
-		}
+	w.WriteHeader(statusCode(r, health.Status, warnStatusCode))
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Println(err)
+	}
+	if mediaType == mediaTypeHealthJson || mediaType == mediaTypeJson {
+		_, _ = log.Writer().Write(buf.Bytes())
 	}
 }
 
@@ -102,14 +137,63 @@ func livenessHandler() http.HandlerFunc {
 }
 
 type Config struct {
-	Port                  string
-	HealthPath            string `mapstructure:"health-path"`
-	LivenessPath          string `mapstructure:"liveness-path"`
-	VeidemannDashboardUrl string `mapstructure:"veidemann-dashboard-url"`
-	ControllerHost        string `mapstructure:"controller-host"`
-	ControllerPort        int    `mapstructure:"controller-port"`
-	ControllerApiKey      string `mapstructure:"controller-api-key"`
-	PrometheusUrl         string `mapstructure:"prometheus-url"`
+	Port                          string
+	HealthPath                    string                        `mapstructure:"health-path"`
+	MetricsPath                   string                        `mapstructure:"metrics-path"`
+	LivenessPath                  string                        `mapstructure:"liveness-path"`
+	VeidemannDashboardUrl         string                        `mapstructure:"veidemann-dashboard-url"`
+	ControllerHost                string                        `mapstructure:"controller-host"`
+	ControllerPort                int                           `mapstructure:"controller-port"`
+	ControllerAuth                string                        `mapstructure:"controller-auth"`
+	ControllerApiKey              string                        `mapstructure:"controller-api-key"`
+	ControllerOIDCTokenUrl        string                        `mapstructure:"controller-oidc-token-url"`
+	ControllerOIDCClientId        string                        `mapstructure:"controller-oidc-client-id"`
+	ControllerOIDCClientSecret    string                        `mapstructure:"controller-oidc-client-secret"`
+	ControllerOIDCScopes          []string                      `mapstructure:"controller-oidc-scopes"`
+	ControllerAllowInsecureApiKey bool                          `mapstructure:"controller-allow-insecure-api-key"`
+	ControllerTLS                 bool                          `mapstructure:"controller-tls"`
+	ControllerCACert              string                        `mapstructure:"controller-ca-cert"`
+	ControllerServerName          string                        `mapstructure:"controller-server-name"`
+	ControllerClientCert          string                        `mapstructure:"controller-client-cert"`
+	ControllerClientKey           string                        `mapstructure:"controller-client-key"`
+	ControllerKeepalive           time.Duration                 `mapstructure:"controller-keepalive"`
+	ControllerMaxBackoff          time.Duration                 `mapstructure:"controller-max-backoff"`
+	PrometheusUrl                 string                        `mapstructure:"prometheus-url"`
+	CrawlLogWindow                time.Duration                 `mapstructure:"crawl-log-window"`
+	CrawlLogMaxEntries            int                           `mapstructure:"crawl-log-max-entries"`
+	CrawlLogWarnRate              float64                       `mapstructure:"crawl-log-warn-rate"`
+	CrawlLogFailRate              float64                       `mapstructure:"crawl-log-fail-rate"`
+	ScheduleWindow                time.Duration                 `mapstructure:"schedule-window"`
+	ScheduleWarnAfter             time.Duration                 `mapstructure:"schedule-warn-after"`
+	ScheduleFailAfter             time.Duration                 `mapstructure:"schedule-fail-after"`
+	CheckInterval                 time.Duration                 `mapstructure:"check-interval"`
+	CheckIntervals                map[string]time.Duration      `mapstructure:"check-intervals"`
+	StaleLimit                    time.Duration                 `mapstructure:"stale-limit"`
+	WarnStatusCode                int                           `mapstructure:"warn-status-code"`
+	PrometheusChecks              []healthcheck.PrometheusCheck `mapstructure:"prometheus-checks"`
+	WebhookUrls                   []string                      `mapstructure:"webhook-urls"`
+	WebhookMaxRetries             int                           `mapstructure:"webhook-max-retries"`
+	WebhookBackoff                time.Duration                 `mapstructure:"webhook-backoff"`
+	WebhookTimeout                time.Duration                 `mapstructure:"webhook-timeout"`
+	WebhookDeadLetterFile         string                        `mapstructure:"webhook-dead-letter-file"`
+	VeidemannApiUrl               string                        `mapstructure:"veidemann-api-url"`
+	GrpcHealthServices            []grpc.Service                `mapstructure:"grpc-health-services"`
+	MaintenancePath               string                        `mapstructure:"maintenance-path"`
+	MaintenanceFile               string                        `mapstructure:"maintenance-file"`
+	MaintenanceWindows            []maintenance.Window          `mapstructure:"maintenance-windows"`
+	MaintenanceToken              string                        `mapstructure:"maintenance-token"`
+	HistoryPath                   string                        `mapstructure:"history-path"`
+	HistoryFile                   string                        `mapstructure:"history-file"`
+	HistorySnapshotInterval       time.Duration                 `mapstructure:"history-snapshot-interval"`
+	HistorySnapshotRetention      time.Duration                 `mapstructure:"history-snapshot-retention"`
+	HistoryRetention              time.Duration                 `mapstructure:"history-retention"`
+	SloPath                       string                        `mapstructure:"slo-path"`
+	EventsPath                    string                        `mapstructure:"events-path"`
+	EventsBufferSize              int                           `mapstructure:"events-buffer-size"`
+	EventsKeepalive               time.Duration                 `mapstructure:"events-keepalive"`
+	SloTarget                     float64                       `mapstructure:"slo-target"`
+	SloWindows                    []time.Duration               `mapstructure:"slo-windows"`
+	Targets                       []Target                      `mapstructure:"targets"`
 }
 
 func main() {
@@ -117,80 +201,300 @@ func main() {
 	port := "8080"
 	healthPath := "/health"
 	livenessPath := "/healthz"
+	metricsPath := "/metrics"
+	maintenancePath := "/maintenance"
+	maintenanceFile := ""
+	maintenanceToken := ""
+	historyPath := "/health/history"
+	historyFile := ""
+	historySnapshotInterval := time.Minute
+	historySnapshotRetention := 24 * time.Hour
+	historyRetention := 30 * 24 * time.Hour
+	sloPath := "/health/slo"
+	eventsPath := "/health/events"
+	eventsBufferSize := 1000
+	eventsKeepalive := 15 * time.Second
+	sloTarget := 99.0
+	sloWindows := []string{"24h", "168h", "720h"}
 	configFileName := "config"
 	configPath := "."
 	controllerHost := "veidemann-controller"
 	controllerPort := 7700
+	controllerAuth := controller.AuthApiKey
 	controllerApiKey := ""
+	controllerOIDCTokenUrl := ""
+	controllerOIDCClientId := ""
+	controllerOIDCClientSecret := ""
+	controllerOIDCScopes := []string{"openid"}
+	controllerAllowInsecureApiKey := false
+	controllerTLS := false
+	controllerCACert := ""
+	controllerServerName := ""
+	controllerClientCert := ""
+	controllerClientKey := ""
+	controllerKeepalive := 5 * time.Minute
+	controllerMaxBackoff := 30 * time.Second
 	prometheusUrl := "http://localhost:9090"
 	veidemannDashboardUrl := "http://localhost/veidemann"
+	crawlLogWindow := 5 * time.Minute
+	crawlLogMaxEntries := 1000
+	crawlLogWarnRate := 10.0
+	crawlLogFailRate := 50.0
+	scheduleWindow := 24 * time.Hour
+	scheduleWarnAfter := 5 * time.Minute
+	scheduleFailAfter := 30 * time.Minute
 	versionsPath := "./versions.json"
+	veidemannApiUrl := "veidemann-api:7700"
+	checkInterval := 30 * time.Second
+	checkIntervals := map[string]string{}
+	staleLimit := time.Duration(0)
+	warnStatusCode := http.StatusOK
+	var webhookUrls []string
+	webhookMaxRetries := 5
+	webhookBackoff := time.Second
+	webhookTimeout := 10 * time.Second
+	webhookDeadLetterFile := ""
 
 	flag.StringVar(&port, "port", port, "Listening port")
 	flag.StringVar(&healthPath, "health-path", healthPath, "URL path of health endpoint")
 	flag.StringVar(&livenessPath, "liveness-path", livenessPath, "URL path of liveness endpoint")
+	flag.StringVar(&metricsPath, "metrics-path", metricsPath, "URL path of Prometheus metrics endpoint")
+	flag.StringVar(&maintenancePath, "maintenance-path", maintenancePath, "URL path of maintenance window API")
+	flag.StringVar(&maintenanceFile, "maintenance-file", maintenanceFile, "File to persist maintenance windows created with the API in")
+	flag.StringVar(&maintenanceToken, "maintenance-token", maintenanceToken, "Bearer token required to change maintenance windows with the API (the API is read-only if empty)")
+	flag.StringVar(&historyPath, "history-path", historyPath, "URL path of health history endpoint")
+	flag.StringVar(&historyFile, "history-file", historyFile, "Database file to record health history in (history is disabled if empty)")
+	flag.DurationVar(&historySnapshotInterval, "history-snapshot-interval", historySnapshotInterval, "Interval between recorded health snapshots")
+	flag.DurationVar(&historySnapshotRetention, "history-snapshot-retention", historySnapshotRetention, "How long recorded health snapshots are kept")
+	flag.DurationVar(&historyRetention, "history-retention", historyRetention, "How long recorded status transitions are kept")
+	flag.StringVar(&sloPath, "slo-path", sloPath, "URL path of availability endpoint (requires history)")
+	flag.Float64Var(&sloTarget, "slo-target", sloTarget, "Availability objective in percent")
+	flag.StringSliceVar(&sloWindows, "slo-windows", sloWindows, "Rolling windows availability is computed over")
+	flag.StringVar(&eventsPath, "events-path", eventsPath, "URL path of Server-Sent Events stream of health changes")
+	flag.IntVar(&eventsBufferSize, "events-buffer-size", eventsBufferSize, "Number of events kept for clients resuming with Last-Event-ID")
+	flag.DurationVar(&eventsKeepalive, "events-keepalive", eventsKeepalive, "Interval between keepalive comments on the event stream")
 	flag.StringVar(&veidemannDashboardUrl, "veidemann-dashboard-url", veidemannDashboardUrl, "URL of veidemann dashboard")
 	flag.StringVar(&controllerHost, "controller-host", controllerHost, "Veidemann controller host")
 	flag.IntVar(&controllerPort, "controller-port", controllerPort, "Veidemann controller port")
 	flag.StringVar(&controllerApiKey, "controller-api-key", controllerApiKey, "Veidemann controller API key")
+	flag.StringVar(&controllerAuth, "controller-auth", controllerAuth, "Controller authentication method (apikey or oidc)")
+	flag.StringVar(&controllerOIDCTokenUrl, "controller-oidc-token-url", controllerOIDCTokenUrl, "Token endpoint of OpenID Connect provider")
+	flag.StringVar(&controllerOIDCClientId, "controller-oidc-client-id", controllerOIDCClientId, "OpenID Connect client id")
+	flag.StringVar(&controllerOIDCClientSecret, "controller-oidc-client-secret", controllerOIDCClientSecret, "OpenID Connect client secret")
+	flag.StringSliceVar(&controllerOIDCScopes, "controller-oidc-scopes", controllerOIDCScopes, "OpenID Connect scopes")
+	flag.BoolVar(&controllerAllowInsecureApiKey, "controller-allow-insecure-api-key", controllerAllowInsecureApiKey, "Allow sending the API key or OpenID Connect token to the controller without TLS")
+	flag.BoolVar(&controllerTLS, "controller-tls", controllerTLS, "Use TLS for the controller connection (implied by --controller-ca-cert and --controller-client-cert)")
+	flag.StringVar(&controllerCACert, "controller-ca-cert", controllerCACert, "Path to CA bundle used to verify the controller (default is the system roots)")
+	flag.StringVar(&controllerServerName, "controller-server-name", controllerServerName, "Server name used to verify the controller certificate")
+	flag.StringVar(&controllerClientCert, "controller-client-cert", controllerClientCert, "Path to client certificate for mutual TLS with the controller")
+	flag.StringVar(&controllerClientKey, "controller-client-key", controllerClientKey, "Path to client key for mutual TLS with the controller")
+	flag.DurationVar(&controllerKeepalive, "controller-keepalive", controllerKeepalive, "Interval between keepalive pings on the controller connection (0 disables keepalive)")
+	flag.DurationVar(&controllerMaxBackoff, "controller-max-backoff", controllerMaxBackoff, "Maximum delay between attempts to reconnect to the controller")
 	flag.StringVar(&prometheusUrl, "prometheus-url", prometheusUrl, "Prometheus HTTP API URL")
-	flag.StringVar(&configFileName, "config-file", configFileName, "Name of config file (without extension)")
+	flag.DurationVar(&crawlLogWindow, "crawl-log-window", crawlLogWindow, "How far back in the crawl log to look when computing the fetch error rate")
+	flag.IntVar(&crawlLogMaxEntries, "crawl-log-max-entries", crawlLogMaxEntries, "Maximum number of crawl log entries read when computing the fetch error rate")
+	flag.Float64Var(&crawlLogWarnRate, "crawl-log-warn-rate", crawlLogWarnRate, "Fetch error rate in percent above which the crawl log check warns (0 disables)")
+	flag.Float64Var(&crawlLogFailRate, "crawl-log-fail-rate", crawlLogFailRate, "Fetch error rate in percent above which the crawl log check fails (0 disables)")
+	flag.DurationVar(&scheduleWindow, "schedule-window", scheduleWindow, "How far back scheduled start times of crawl jobs are checked")
+	flag.DurationVar(&scheduleWarnAfter, "schedule-warn-after", scheduleWarnAfter, "Time after scheduled start before a job that has not started is reported as overdue")
+	flag.DurationVar(&scheduleFailAfter, "schedule-fail-after", scheduleFailAfter, "Time after scheduled start before a job that has not started is reported as missed")
+	flag.StringVar(&veidemannApiUrl, "veidemann-api-url", veidemannApiUrl, "Default address (host:port) of gRPC services checked with the gRPC health checking protocol")
+	flag.StringVar(&configFileName, "config-file", configFileName, "Name of config file (without extension) to look for in --config-path, or path to config file")
 	flag.StringVar(&configPath, "config-path", configPath, "Path to look for config file in")
 	flag.StringVar(&versionsPath, "versions-path", versionsPath, "Path to versions file")
+	flag.DurationVar(&checkInterval, "check-interval", checkInterval, "Interval between background refreshes of check results")
+	flag.StringToStringVar(&checkIntervals, "check-intervals", checkIntervals, "Refresh interval per component id (e.g. veidemann:dashboard=10s)")
+	flag.IntVar(&warnStatusCode, "warn-status-code", warnStatusCode, "HTTP status code of health responses with status warn")
+	flag.StringSliceVar(&webhookUrls, "webhook-urls", webhookUrls, "Webhook URLs to notify of component status changes")
+	flag.IntVar(&webhookMaxRetries, "webhook-max-retries", webhookMaxRetries, "Number of retries of failed webhook deliveries")
+	flag.DurationVar(&webhookBackoff, "webhook-backoff", webhookBackoff, "Delay before first retry of failed webhook delivery, doubled for every retry")
+	flag.DurationVar(&webhookTimeout, "webhook-timeout", webhookTimeout, "Timeout of webhook delivery")
+	flag.StringVar(&webhookDeadLetterFile, "webhook-dead-letter-file", webhookDeadLetterFile, "File to append undeliverable webhook notifications to (default is to log them)")
+	flag.DurationVar(&staleLimit, "stale-limit", staleLimit, "Age after which a check result is flagged as stale (0 means twice the refresh interval)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  check            Run checks once and print the result in Nagios plugin format\n")
+		fmt.Fprintf(os.Stderr, "  validate-config  Validate the configuration and print the effective configuration\n\n")
+		fmt.Fprintf(os.Stderr, "Without a command the health check API is served.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	// the check command reports setup errors with the Nagios exit code unknown
+	fatal := func(err error) {
+		log.Fatal(err)
+	}
+	if flag.Arg(0) == "check" {
+		fatal = func(err error) {
+			os.Exit(checkError(err))
+		}
+	}
+
 	err := viper.BindPFlags(flag.CommandLine)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv()
-	viper.SetConfigFile(configFileName)
-	viper.AddConfigPath(configPath)
+	if filepath.Ext(configFileName) != "" {
+		viper.SetConfigFile(configFileName)
+	} else {
+		viper.SetConfigName(configFileName)
+		viper.AddConfigPath(configPath)
+	}
 	err = viper.ReadInConfig()
 	if err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			panic(err)
+		// a config file is optional unless the file is given with extension
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			fatal(err)
 		}
 	}
 
-	var config Config
-	err = viper.Unmarshal(&config)
+	if flag.Arg(0) == "validate-config" {
+		os.Exit(validate())
+	}
+
+	config, err := readConfig()
 	if err != nil {
-		panic(err)
+		fatal(err)
 	}
 
-	healthCheckerOptions := healthcheck.Options{
-		Controller: controller.Options{
-			Host:   config.ControllerHost,
-			Port:   config.ControllerPort,
-			ApiKey: config.ControllerApiKey,
-		},
-		WebOptions: web.Options{
-			VeidemannDashboardUrl: config.VeidemannDashboardUrl,
-		},
-		Prometheus: prometheus.Options{
-			Address: config.PrometheusUrl,
-		},
+	healthChecker, err := config.newHealthChecker()
+	if err != nil {
+		fatal(err)
 	}
-	healthChecker := healthcheck.NewHealthChecker(&healthCheckerOptions)
 
-	health := &api.Health{
+	maintenanceWindows, err := maintenance.New(maintenance.Options{
+		File:    config.MaintenanceFile,
+		Windows: config.MaintenanceWindows,
+		Token:   config.MaintenanceToken,
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	switch command := flag.Arg(0); command {
+	case "":
+	case "check":
+		os.Exit(check(healthChecker, maintenanceWindows))
+	default:
+		flag.Usage()
+		log.Fatalf("unknown command: %s", command)
+	}
+
+	scheduler, err := healthcheck.NewScheduler(healthChecker, config.schedulerOptions())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scheduler.Filter(maintenanceWindows.Apply)
+
+	exporter, err := metrics.New(prom.DefaultRegisterer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheduler.Observe(exporter.Observe)
+	scheduler.Forget(exporter.Remove)
+
+	var notifier *webhook.Notifier
+	if len(config.WebhookUrls) > 0 {
+		notifier = webhook.New(webhook.Options{
+			Urls:           config.WebhookUrls,
+			MaxRetries:     config.WebhookMaxRetries,
+			Backoff:        config.WebhookBackoff,
+			Timeout:        config.WebhookTimeout,
+			DeadLetterFile: config.WebhookDeadLetterFile,
+		})
+		scheduler.Observe(notifier.Observe)
+	}
+
+	health := api.Health{
 		Version: version.Version,
-		Notes:  version.GetNotes(versionsPath),
+		Notes:   version.GetNotes(versionsPath),
+	}
+
+	broker, err := events.New(events.Options{
+		BufferSize: config.EventsBufferSize,
+		Keepalive:  config.EventsKeepalive,
+	}, func() *api.Health {
+		return healthcheck.Aggregate(health, scheduler.Snapshot)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheduler.Observe(broker.Observe)
+
+	var healthHistory *history.History
+	if config.HistoryFile != "" {
+		healthHistory, err = history.New(history.Options{
+			File:                config.HistoryFile,
+			SnapshotInterval:    config.HistorySnapshotInterval,
+			SnapshotRetention:   config.HistorySnapshotRetention,
+			TransitionRetention: config.HistoryRetention,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		scheduler.Observe(healthHistory.Observe)
+	}
+
+	var availability *slo.SLO
+	if healthHistory != nil {
+		availability, err = slo.New(healthHistory, slo.Options{
+			Target:  config.SloTarget,
+			Windows: config.SloWindows,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := prom.DefaultRegisterer.Register(availability); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	scheduler.Start()
+	watchConfig(scheduler, maintenanceWindows, config)
+
+	if healthHistory != nil {
+		healthHistory.Start(func() *api.Health {
+			return healthcheck.Aggregate(api.Health{}, scheduler.Snapshot)
+		})
 	}
 
 	router := http.NewServeMux()
 	router.HandleFunc(config.LivenessPath, livenessHandler())
-	router.HandleFunc(config.HealthPath, healthCheckHandler(healthChecker, health))
+	router.Handle(config.MetricsPath, promhttp.Handler())
+	maintenanceHandler := maintenanceWindows.Handler(config.MaintenancePath)
+	maintenancePrefix := strings.TrimSuffix(config.MaintenancePath, "/") + "/"
+	if config.MaintenancePath != maintenancePrefix {
+		router.Handle(config.MaintenancePath, maintenanceHandler)
+	}
+	router.Handle(maintenancePrefix, maintenanceHandler)
+	// the component path is the same as the health path if it ends with a slash
+	componentPath := strings.TrimSuffix(config.HealthPath, "/") + "/"
+	if config.HealthPath != componentPath {
+		router.HandleFunc(config.HealthPath, healthCheckHandler(scheduler, health, config.WarnStatusCode))
+	}
+	if healthHistory != nil {
+		router.HandleFunc(config.HistoryPath, healthHistory.Handler())
+		router.HandleFunc(config.SloPath, availability.Handler())
+	}
+	router.HandleFunc(config.EventsPath, broker.Handler())
+	router.HandleFunc(componentPath, componentHealthCheckHandler(scheduler, health, config.WarnStatusCode, componentPath))
 
 	srv := &http.Server{
 		Addr:    ":" + config.Port,
 		Handler: router,
 	}
+	// event streams don't end by themselves
+	srv.RegisterOnShutdown(broker.Close)
 
 	// shutdown gracefully
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		done := make(chan os.Signal, 1)
 		signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -202,9 +506,91 @@ func main() {
 		if err := srv.Shutdown(ctx); err != nil {
 			log.Fatal(err)
 		}
+		scheduler.Stop()
+		if err := scheduler.HealthChecker().Close(); err != nil {
+			log.Println(err)
+		}
+		if notifier != nil {
+			notifier.Close()
+		}
+		if healthHistory != nil {
+			if err := healthHistory.Close(); err != nil {
+				log.Println(err)
+			}
+		}
 	}()
 
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+	// wait for the checks to stop and the history to be closed
+	<-stopped
+}
+
+// readConfig reads the configuration from viper and validates it.
+func readConfig() (*Config, error) {
+	config, problems := validateConfig()
+	if len(problems) > 0 {
+		return nil, invalidConfigError(problems)
+	}
+	return config, nil
+}
+
+// healthCheckerOptions returns the options of the health checker.
+func (config *Config) healthCheckerOptions() healthcheck.Options {
+	return healthcheck.Options{
+		Controller: controller.Options{
+			Host:   config.ControllerHost,
+			Port:   config.ControllerPort,
+			Auth:   config.ControllerAuth,
+			ApiKey: config.ControllerApiKey,
+			OIDC: controller.OIDCOptions{
+				TokenUrl:     config.ControllerOIDCTokenUrl,
+				ClientId:     config.ControllerOIDCClientId,
+				ClientSecret: config.ControllerOIDCClientSecret,
+				Scopes:       config.ControllerOIDCScopes,
+			},
+			AllowInsecureApiKey: config.ControllerAllowInsecureApiKey,
+			TLS: controller.TLSOptions{
+				Enabled:            config.ControllerTLS,
+				CACert:             config.ControllerCACert,
+				ServerNameOverride: config.ControllerServerName,
+				ClientCert:         config.ControllerClientCert,
+				ClientKey:          config.ControllerClientKey,
+			},
+			KeepaliveTime:     config.ControllerKeepalive,
+			MaxReconnectDelay: config.ControllerMaxBackoff,
+		},
+		CrawlLog: healthcheck.CrawlLogOptions{
+			Window:     config.CrawlLogWindow,
+			MaxEntries: config.CrawlLogMaxEntries,
+			WarnRate:   config.CrawlLogWarnRate,
+			FailRate:   config.CrawlLogFailRate,
+		},
+		Schedule: healthcheck.ScheduleOptions{
+			Window:    config.ScheduleWindow,
+			WarnAfter: config.ScheduleWarnAfter,
+			FailAfter: config.ScheduleFailAfter,
+		},
+		WebOptions: web.Options{
+			VeidemannDashboardUrl: config.VeidemannDashboardUrl,
+		},
+		Prometheus: prometheus.Options{
+			Address: config.PrometheusUrl,
+		},
+		PrometheusChecks: config.PrometheusChecks,
+		Grpc: grpc.Options{
+			VeidemannApiUrl: config.VeidemannApiUrl,
+		},
+		GrpcServices: config.GrpcHealthServices,
+	}
+}
+
+// schedulerOptions returns the options of the scheduler.
+func (config *Config) schedulerOptions() healthcheck.SchedulerOptions {
+	return healthcheck.SchedulerOptions{
+		Interval:   config.CheckInterval,
+		Intervals:  config.CheckIntervals,
+		StaleLimit: config.StaleLimit,
+	}
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/controller"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/prometheus"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/web"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+)
+
+// statusRank orders statuses by severity like the aggregation does.
+var statusRank = map[api.Status]int{
+	"":                  0,
+	api.StatusHealthy:   1,
+	api.StatusWarn:      2,
+	api.StatusUnhealthy: 3,
+}
+
+func newTestHealthChecker(t *testing.T, url string, checkId string) *healthcheck.HealthChecker {
+	hc, err := healthcheck.NewHealthChecker(&healthcheck.Options{
+		// nothing listens on port 1, so the controller checks fail fast
+		Controller:       controller.Options{Host: "127.0.0.1", Port: 1},
+		CrawlLog:         healthcheck.CrawlLogOptions{Window: time.Minute, MaxEntries: 10},
+		Schedule:         healthcheck.ScheduleOptions{Window: time.Hour},
+		WebOptions:       web.Options{VeidemannDashboardUrl: url},
+		Prometheus:       prometheus.Options{Address: url},
+		PrometheusChecks: []healthcheck.PrometheusCheck{{Id: checkId, Query: "x", Warn: "> 1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hc
+}
+
+// TestHealthCheckHandlerConcurrent requests the health from many goroutines
+// while the health checker is replaced, and checks that every response is a
+// complete document of one health checker. Run with -race.
+func TestHealthCheckHandlerConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"scalar","result":[%d,"2"]}}`, time.Now().Unix())
+	}))
+	defer server.Close()
+
+	options := healthcheck.SchedulerOptions{Interval: 5 * time.Millisecond}
+	scheduler, err := healthcheck.NewScheduler(newTestHealthChecker(t, server.URL, "test:a"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler.Start()
+	defer func() {
+		scheduler.Stop()
+		_ = scheduler.HealthChecker().Close()
+	}()
+
+	handler := healthCheckHandler(scheduler, api.Health{Version: "test"}, http.StatusOK)
+
+	done := make(chan struct{})
+	var reloads sync.WaitGroup
+	reloads.Add(1)
+	go func() {
+		defer reloads.Done()
+		ids := []string{"test:b", "test:a"}
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			old, err := scheduler.Reload(newTestHealthChecker(t, server.URL, ids[i%2]), options)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = old.Close()
+		}
+	}()
+
+	var requests sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+			for j := 0; j < 25; j++ {
+				rec := httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+				checkDocument(t, rec)
+			}
+		}()
+	}
+	requests.Wait()
+	close(done)
+	reloads.Wait()
+}
+
+func checkDocument(t *testing.T, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	var health api.Health
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Errorf("incomplete document: %v: %s", err, rec.Body.String())
+		return
+	}
+	if health.Version != "test" {
+		t.Errorf("expected version test, got %q", health.Version)
+	}
+	_, a := health.Checks["test:a"]
+	_, b := health.Checks["test:b"]
+	if a && b {
+		t.Errorf("document mixes results of two health checkers: %s", rec.Body.String())
+	}
+	worst := api.Status("")
+	for _, checks := range health.Checks {
+		for _, check := range checks {
+			if statusRank[check.Status] > statusRank[worst] {
+				worst = check.Status
+			}
+		}
+	}
+	if health.Status != worst {
+		t.Errorf("expected status %q of the worst check, got %q", worst, health.Status)
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		query          string
+		status         api.Status
+		warnStatusCode int
+		code           int
+	}{
+		{"", api.StatusHealthy, http.StatusOK, http.StatusOK},
+		{"", "", http.StatusOK, http.StatusOK},
+		{"", api.StatusWarn, http.StatusOK, http.StatusOK},
+		{"", api.StatusWarn, http.StatusMultiStatus, http.StatusMultiStatus},
+		{"", api.StatusWarn, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		{"", api.StatusUnhealthy, http.StatusOK, http.StatusServiceUnavailable},
+		{"?force200", api.StatusUnhealthy, http.StatusOK, http.StatusOK},
+		{"?force200=true", api.StatusUnhealthy, http.StatusOK, http.StatusOK},
+		{"?force200=1", api.StatusWarn, http.StatusMultiStatus, http.StatusOK},
+		{"?force200=false", api.StatusUnhealthy, http.StatusOK, http.StatusServiceUnavailable},
+		{"?force200=maybe", api.StatusWarn, http.StatusMultiStatus, http.StatusMultiStatus},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/health"+test.query, nil)
+		if code := statusCode(r, test.status, test.warnStatusCode); code != test.code {
+			t.Errorf("%s with %q and warn status code %d: expected %d, got %d", test.query, test.status, test.warnStatusCode, test.code, code)
+		}
+	}
+}
+
+func TestWriteHealth(t *testing.T) {
+	health := &api.Health{Status: api.StatusUnhealthy, Version: "test", Checks: api.Checks{
+		"test:a": {{Status: api.StatusUnhealthy}},
+	}}
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", mediaTypeHealthJson},
+		{"application/json", mediaTypeJson + "; charset=UTF-8"},
+		{"text/html", mediaTypeHtml + "; charset=UTF-8"},
+		{"text/plain", mediaTypeText + "; charset=UTF-8"},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/health", nil)
+		r.Header.Set("Accept", test.accept)
+		writeHealth(rec, r, health, http.StatusOK)
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%q: expected status code %d, got %d", test.accept, http.StatusServiceUnavailable, rec.Code)
+		}
+		if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, test.contentType) {
+			t.Errorf("%q: expected content type %s, got %s", test.accept, test.contentType, contentType)
+		}
+		if rec.Body.Len() == 0 {
+			t.Errorf("%q: expected a body", test.accept)
+		}
+	}
+}
+
+func TestWriteHealthError(t *testing.T) {
+	// a value that can't be encoded is reported instead of an incomplete document
+	health := &api.Health{Status: api.StatusHealthy, Checks: api.Checks{
+		"test:a": {{Status: api.StatusHealthy, ObservedValue: make(chan int)}},
+	}}
+	rec := httptest.NewRecorder()
+	writeHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil), health, http.StatusOK)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
@@ -46,6 +46,8 @@ type Check struct {
 	Status            Status   `json:"status,omitempty"`
 	AffectedEndpoints []string `json:"affectedEndpoints,omitempty"`
 	Time              string   `json:"time,omitempty"`
+	Age               string   `json:"age,omitempty"`
+	Stale             bool     `json:"stale,omitempty"`
 	Output            string   `json:"output,omitempty"`
 	Links             []string `json:"links,omitempty"`
 	Description       string   `json:"description,omitempty"`
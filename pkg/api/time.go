@@ -3,5 +3,9 @@ package api
 import "time"
 
 func GetCurrentTime() string {
-	return time.Now().Format(time.RFC3339)
+	return FormatTime(time.Now())
+}
+
+func FormatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
 }
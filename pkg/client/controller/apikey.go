@@ -3,7 +3,8 @@ package controller
 import "context"
 
 type apiKeyCredentials struct {
-	Key string
+	Key           string
+	AllowInsecure bool
 }
 
 // implement credentials.PerRPCCredentials interface
@@ -15,5 +16,5 @@ func (akc apiKeyCredentials) GetRequestMetadata(ctx context.Context, uri ...stri
 
 // implement credentials.PerRPCCredentials interface
 func (akc apiKeyCredentials) RequireTransportSecurity() bool {
-	return false
+	return !akc.AllowInsecure
 }
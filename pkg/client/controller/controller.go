@@ -16,46 +16,119 @@
 package controller
 
 import (
-	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 )
 
 type Options struct {
-	Host   string
-	Port   int
+	Host string
+	Port int
+	// Auth is the authentication method, AuthApiKey (default) or AuthOIDC.
+	Auth   string
 	ApiKey string
+	OIDC   OIDCOptions
+	// AllowInsecureApiKey allows the API key or OIDC token to be sent without transport security.
+	AllowInsecureApiKey bool
+	TLS                 TLSOptions
+	// KeepaliveTime is the interval between keepalive pings on an idle
+	// connection. Zero disables keepalive pings.
+	KeepaliveTime time.Duration
+	// MaxReconnectDelay is the upper bound of the reconnect backoff.
+	MaxReconnectDelay time.Duration
 }
 
 // Client represents the client to the aggregator service.
 type Client struct {
 	address string // address in the form "host:port"
-	cred    credentials.PerRPCCredentials
+	conn    *grpc.ClientConn
 }
 
 // New creates a new client with the specified address and apiKey.
-func New(options Options) Client {
-	return Client{
-		address: options.Host + ":" + strconv.FormatInt(int64(options.Port), 10),
-		cred:    apiKeyCredentials{Key: options.ApiKey},
+//
+// The client keeps one connection to the gRPC service that is reestablished
+// with exponential backoff when it fails. The connection is made in the
+// background, so New does not fail if the service is unavailable.
+func New(options Options) (*Client, error) {
+	address := options.Host + ":" + strconv.FormatInt(int64(options.Port), 10)
+
+	backoffConfig := backoff.DefaultConfig
+	if options.MaxReconnectDelay > 0 {
+		backoffConfig.MaxDelay = options.MaxReconnectDelay
+	}
+	dialOptions := []grpc.DialOption{
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoffConfig,
+			MinConnectTimeout: 5 * time.Second,
+		}),
+	}
+	if options.TLS.enabled() {
+		creds, err := transportCredentials(options.TLS)
+		if err != nil {
+			return nil, err
+		}
+		dialOptions = append(dialOptions, grpc.WithTransportCredentials(creds))
+	} else {
+		dialOptions = append(dialOptions, grpc.WithInsecure())
+	}
+	creds, err := perRPCCredentials(options)
+	if err != nil {
+		return nil, err
+	}
+	if creds != nil {
+		if creds.RequireTransportSecurity() && !options.TLS.enabled() {
+			return nil, fmt.Errorf("refusing to send credentials to %s without transport security", address)
+		}
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(creds))
+	}
+	if options.KeepaliveTime > 0 {
+		dialOptions = append(dialOptions, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    options.KeepaliveTime,
+			Timeout: 20 * time.Second,
+		}))
 	}
-}
 
-// Dial makes a connection to the gRPC service.
-func (ac Client) dial(ctx context.Context) (*grpc.ClientConn, error) {
-	conn, err := grpc.DialContext(ctx, ac.address, grpc.WithInsecure(), grpc.WithPerRPCCredentials(ac.cred))
+	conn, err := grpc.Dial(address, dialOptions...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to dial %s: %w", ac.address, err)
+		return nil, fmt.Errorf("failed to dial %s: %w", address, err)
 	}
-	return conn, nil
+	return &Client{
+		address: address,
+		conn:    conn,
+	}, nil
 }
 
-// Hangup closes the connection to the gRPC service.
-func (ac Client) hangup(conn *grpc.ClientConn) {
-	if conn != nil {
-		_ = conn.Close()
+// perRPCCredentials returns the credentials of the configured authentication
+// method, or nil if there are no credentials to send.
+func perRPCCredentials(options Options) (credentials.PerRPCCredentials, error) {
+	switch options.Auth {
+	case "", AuthApiKey:
+		if options.ApiKey == "" {
+			return nil, nil
+		}
+		return apiKeyCredentials{
+			Key:           options.ApiKey,
+			AllowInsecure: options.AllowInsecureApiKey,
+		}, nil
+	case AuthOIDC:
+		return newOIDCCredentials(options.OIDC, options.AllowInsecureApiKey)
+	default:
+		return nil, fmt.Errorf("unknown authentication method: %s", options.Auth)
 	}
 }
+
+// State returns the connectivity state of the connection to the gRPC service.
+func (ac *Client) State() connectivity.State {
+	return ac.conn.GetState()
+}
+
+// Close closes the connection to the gRPC service.
+func (ac *Client) Close() error {
+	return ac.conn.Close()
+}
@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestNewRefusesCredentialsWithoutTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{"api key", Options{Host: "localhost", Port: 7700, ApiKey: "secret"}},
+		{"oidc", Options{Host: "localhost", Port: 7700, Auth: AuthOIDC, OIDC: OIDCOptions{TokenUrl: "http://localhost/token", ClientId: "id"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if c, err := New(test.options); err == nil {
+				_ = c.Close()
+				t.Error("expected credentials without transport security to be refused")
+			}
+
+			test.options.AllowInsecureApiKey = true
+			c, err := New(test.options)
+			if err != nil {
+				t.Fatalf("expected insecure credentials to be allowed: %v", err)
+			}
+			_ = c.Close()
+		})
+	}
+}
+
+// certificate is a PEM encoded certificate and key written to files.
+type certificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	tls      tls.Certificate
+	certFile string
+	keyFile  string
+}
+
+// newCertificate creates a certificate signed by parent, or a self-signed CA
+// certificate if parent is nil, and writes it to dir.
+func newCertificate(t *testing.T, dir string, name string, parent *certificate) *certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{name},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	tlsCert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &certificate{
+		cert:     cert,
+		key:      key,
+		tls:      tlsCert,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	if err := ioutil.WriteFile(c.certFile, certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(c.keyFile, keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newCertificate(t, dir, "ca", nil)
+	serverCert := newCertificate(t, dir, "veidemann-controller", ca)
+	clientCert := newCertificate(t, dir, "health-check", ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	serverCreds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert.tls},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+
+	// the server records the authorization metadata of the last request
+	authorization := make(chan []string, 10)
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		authorization <- md.Get("authorization")
+		return handler(ctx, req)
+	}
+	server := grpc.NewServer(grpc.Creds(serverCreds), grpc.UnaryInterceptor(interceptor))
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(options Options) error {
+		c, err := New(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = grpc_health_v1.NewHealthClient(c.conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		return err
+	}
+
+	options := Options{
+		Host:   host,
+		Port:   portNumber,
+		ApiKey: "secret",
+		TLS: TLSOptions{
+			CACert:             ca.certFile,
+			ServerNameOverride: "veidemann-controller",
+			ClientCert:         clientCert.certFile,
+			ClientKey:          clientCert.keyFile,
+		},
+	}
+	if err := check(options); err != nil {
+		t.Fatalf("expected successful mutual TLS handshake: %v", err)
+	}
+	if got := <-authorization; len(got) != 1 || got[0] != "apikey secret" {
+		t.Errorf("expected api key to be sent, got %v", got)
+	}
+
+	// the server requires a client certificate
+	withoutClientCert := options
+	withoutClientCert.TLS.ClientCert = ""
+	withoutClientCert.TLS.ClientKey = ""
+	if err := check(withoutClientCert); err == nil {
+		t.Error("expected handshake without client certificate to fail")
+	}
+
+	// the server certificate is not valid for the host name
+	withoutServerName := options
+	withoutServerName.TLS.ServerNameOverride = ""
+	if err := check(withoutServerName); err == nil {
+		t.Error("expected verification of server certificate to fail")
+	}
+}
+
+func TestTransportCredentialsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	notPem := filepath.Join(dir, "not.pem")
+	if err := ioutil.WriteFile(notPem, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options TLSOptions
+	}{
+		{"missing CA certificate", TLSOptions{CACert: filepath.Join(dir, "missing.pem")}},
+		{"invalid CA certificate", TLSOptions{CACert: notPem}},
+		{"client certificate without key", TLSOptions{ClientCert: notPem}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := transportCredentials(test.options); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
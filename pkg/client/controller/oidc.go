@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AuthApiKey = "apikey"
+	AuthOIDC   = "oidc"
+)
+
+type OIDCOptions struct {
+	// TokenUrl is the token endpoint of the OpenID Connect provider.
+	TokenUrl     string
+	ClientId     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// tokens without expiry are refreshed after this duration
+const defaultTokenLifetime = 5 * time.Minute
+
+// tokens are refreshed this long before they expire, but at most a quarter of
+// their lifetime, so short-lived tokens are not refreshed on every request
+const tokenExpiryLeeway = 30 * time.Second
+
+// oidcCredentials gets bearer tokens with the OAuth2 client credentials flow
+// and caches them until they expire.
+type oidcCredentials struct {
+	options       OIDCOptions
+	allowInsecure bool
+	client        *http.Client
+	now           func() time.Time
+
+	mu    sync.Mutex
+	token string
+	// refresh is when the token is about to expire
+	refresh time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func newOIDCCredentials(options OIDCOptions, allowInsecure bool) (*oidcCredentials, error) {
+	if options.TokenUrl == "" {
+		return nil, fmt.Errorf("missing OIDC token URL")
+	}
+	if options.ClientId == "" {
+		return nil, fmt.Errorf("missing OIDC client id")
+	}
+	return &oidcCredentials{
+		options:       options,
+		allowInsecure: allowInsecure,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		now:           time.Now,
+	}, nil
+}
+
+// implement credentials.PerRPCCredentials interface
+func (oc *oidcCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := oc.getToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"authorization": "Bearer " + token,
+	}, nil
+}
+
+// implement credentials.PerRPCCredentials interface
+func (oc *oidcCredentials) RequireTransportSecurity() bool {
+	return !oc.allowInsecure
+}
+
+// getToken returns the cached token or requests a new one if it is about to expire.
+func (oc *oidcCredentials) getToken(ctx context.Context) (string, error) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	now := oc.now()
+	if oc.token != "" && now.Before(oc.refresh) {
+		return oc.token, nil
+	}
+
+	resp, err := oc.requestToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	lifetime := defaultTokenLifetime
+	if resp.ExpiresIn > 0 {
+		lifetime = time.Duration(resp.ExpiresIn) * time.Second
+	}
+	leeway := tokenExpiryLeeway
+	if leeway > lifetime/4 {
+		leeway = lifetime / 4
+	}
+	oc.token = resp.AccessToken
+	oc.refresh = now.Add(lifetime - leeway)
+
+	return oc.token, nil
+}
+
+func (oc *oidcCredentials) requestToken(ctx context.Context) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+	}
+	if len(oc.options.Scopes) > 0 {
+		form.Set("scope", strings.Join(oc.options.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oc.options.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(oc.options.ClientId), url.QueryEscape(oc.options.ClientSecret))
+
+	resp, err := oc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to request token: %s", resp.Status)
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token response is missing access token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return nil, fmt.Errorf("unsupported token type: %s", token.TokenType)
+	}
+	return &token, nil
+}
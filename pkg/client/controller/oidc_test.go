@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenServer is a fake token endpoint that issues a new token for every request.
+type tokenServer struct {
+	tokenType string
+	expiresIn int64
+
+	mu       sync.Mutex
+	requests int
+	forms    []map[string][]string
+	users    []string
+}
+
+func (ts *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.requests++
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ts.forms = append(ts.forms, r.PostForm)
+	user, password, _ := r.BasicAuth()
+	ts.users = append(ts.users, user+":"+password)
+	if password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tokenResponse{
+		AccessToken: fmt.Sprintf("token-%d", ts.requests),
+		TokenType:   ts.tokenType,
+		ExpiresIn:   ts.expiresIn,
+	})
+}
+
+func newTestOIDCCredentials(t *testing.T, url string, clientSecret string, now *time.Time) *oidcCredentials {
+	t.Helper()
+	oc, err := newOIDCCredentials(OIDCOptions{
+		TokenUrl:     url,
+		ClientId:     "health-check",
+		ClientSecret: clientSecret,
+		Scopes:       []string{"openid", "veidemann"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oc.now = func() time.Time { return *now }
+	return oc
+}
+
+func authorization(t *testing.T, oc *oidcCredentials) string {
+	t.Helper()
+	md, err := oc.GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return md["authorization"]
+}
+
+func TestOIDCTokenIsCachedUntilExpiry(t *testing.T) {
+	ts := &tokenServer{tokenType: "Bearer", expiresIn: 300}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+
+	now := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	oc := newTestOIDCCredentials(t, server.URL, "secret", &now)
+
+	if got := authorization(t, oc); got != "Bearer token-1" {
+		t.Errorf("expected Bearer token-1, got %s", got)
+	}
+	now = now.Add(4 * time.Minute)
+	if got := authorization(t, oc); got != "Bearer token-1" {
+		t.Errorf("expected cached token, got %s", got)
+	}
+	if ts.requests != 1 {
+		t.Errorf("expected 1 token request, got %d", ts.requests)
+	}
+
+	// the token is refreshed before it expires
+	now = now.Add(time.Minute - tokenExpiryLeeway)
+	if got := authorization(t, oc); got != "Bearer token-2" {
+		t.Errorf("expected refreshed token, got %s", got)
+	}
+	if ts.requests != 2 {
+		t.Errorf("expected 2 token requests, got %d", ts.requests)
+	}
+
+	form := ts.forms[0]
+	if form["grant_type"][0] != "client_credentials" || form["scope"][0] != "openid veidemann" {
+		t.Errorf("unexpected token request: %v", form)
+	}
+	if ts.users[0] != "health-check:secret" {
+		t.Errorf("unexpected client credentials: %s", ts.users[0])
+	}
+}
+
+func TestOIDCTokenWithoutExpiry(t *testing.T) {
+	ts := &tokenServer{}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+
+	now := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	oc := newTestOIDCCredentials(t, server.URL, "secret", &now)
+
+	authorization(t, oc)
+	now = now.Add(defaultTokenLifetime - tokenExpiryLeeway - time.Second)
+	authorization(t, oc)
+	if ts.requests != 1 {
+		t.Errorf("expected token to be cached for the default lifetime, got %d requests", ts.requests)
+	}
+	now = now.Add(time.Second)
+	authorization(t, oc)
+	if ts.requests != 2 {
+		t.Errorf("expected token to be refreshed after the default lifetime, got %d requests", ts.requests)
+	}
+}
+
+func TestOIDCShortLivedToken(t *testing.T) {
+	// a token that expires within the leeway is still cached for most of its lifetime
+	for _, expiresIn := range []int64{30, 10, 1} {
+		ts := &tokenServer{tokenType: "Bearer", expiresIn: expiresIn}
+		server := httptest.NewServer(ts)
+
+		now := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+		oc := newTestOIDCCredentials(t, server.URL, "secret", &now)
+		lifetime := time.Duration(expiresIn) * time.Second
+
+		authorization(t, oc)
+		authorization(t, oc)
+		now = now.Add(lifetime*3/4 - time.Millisecond)
+		authorization(t, oc)
+		if ts.requests != 1 {
+			t.Errorf("expires in %ds: expected token to be cached, got %d requests", expiresIn, ts.requests)
+		}
+		now = now.Add(time.Millisecond)
+		authorization(t, oc)
+		if ts.requests != 2 {
+			t.Errorf("expires in %ds: expected token to be refreshed before it expires, got %d requests", expiresIn, ts.requests)
+		}
+		server.Close()
+	}
+}
+
+func TestOIDCTokenErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		tokenType    string
+		clientSecret string
+	}{
+		{"unsupported token type", "mac", "secret"},
+		{"unauthorized client", "bearer", "wrong"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts := &tokenServer{tokenType: test.tokenType}
+			server := httptest.NewServer(ts)
+			defer server.Close()
+
+			now := time.Now()
+			oc := newTestOIDCCredentials(t, server.URL, test.clientSecret, &now)
+			if md, err := oc.GetRequestMetadata(context.Background()); err == nil {
+				t.Errorf("expected error, got %v", md)
+			}
+			if oc.token != "" {
+				t.Errorf("expected no token to be cached, got %s", oc.token)
+			}
+		})
+	}
+}
@@ -4,28 +4,29 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
+	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/nlnwa/veidemann-api-go/config/v1"
 	"github.com/nlnwa/veidemann-api-go/controller/v1"
 	"github.com/nlnwa/veidemann-api-go/frontier/v1"
 	"github.com/nlnwa/veidemann-api-go/report/v1"
+	"google.golang.org/grpc/connectivity"
 )
 
 type Query interface {
-	GetRunningJobs(ctx context.Context) ([]string, error)
 	GetRunStatus(ctx context.Context) (*controller.RunStatus, error)
+	ListRunningJobExecutions(ctx context.Context) ([]*frontier.JobExecutionStatus, error)
+	ListJobExecutionsStartedSince(ctx context.Context, since time.Time) ([]*frontier.JobExecutionStatus, error)
+	ListConfigObjects(ctx context.Context, kind config.Kind, ids ...string) ([]*config.ConfigObject, error)
+	ListRecentCrawlLogs(ctx context.Context, since time.Time, max int) ([]*frontier.CrawlLog, error)
+	State() connectivity.State
 }
 
-func (ac Client) listRunningJobExecutionStatuses(ctx context.Context) ([]*frontier.JobExecutionStatus, error) {
-	conn, err := ac.dial(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = conn.Close()
-	}()
-
-	client := report.NewReportClient(conn)
+// ListRunningJobExecutions returns the status of all running job executions.
+func (ac *Client) ListRunningJobExecutions(ctx context.Context) ([]*frontier.JobExecutionStatus, error) {
+	client := report.NewReportClient(ac.conn)
 
 	req := &report.JobExecutionsListRequest{
 		State: []frontier.JobExecutionStatus_State{
@@ -51,29 +52,39 @@ func (ac Client) listRunningJobExecutionStatuses(ctx context.Context) ([]*fronti
 	return jeses, nil
 }
 
-func (ac Client) GetRunningJobs(ctx context.Context) ([]string, error) {
-	var ids []string
+// ListJobExecutionsStartedSince returns the status of all job executions,
+// in any state, that started at or after since.
+func (ac *Client) ListJobExecutionsStartedSince(ctx context.Context, since time.Time) ([]*frontier.JobExecutionStatus, error) {
+	client := report.NewReportClient(ac.conn)
 
-	jeses, err := ac.listRunningJobExecutionStatuses(ctx)
+	startTimeFrom, err := ptypes.TimestampProto(since)
 	if err != nil {
-		return ids, err
+		return nil, err
 	}
-	for _, jes := range jeses {
-		ids = append(ids, jes.GetId())
+	req := &report.JobExecutionsListRequest{
+		StartTimeFrom: startTimeFrom,
 	}
-	return ids, nil
-}
 
-func (ac Client) GetRunStatus(ctx context.Context) (*controller.RunStatus, error) {
-	conn, err := ac.dial(ctx)
+	stream, err := client.ListJobExecutions(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to list job executions: %w", err)
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
+	var jeses []*frontier.JobExecutionStatus
+	for {
+		jobExecutionStatus, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		jeses = append(jeses, jobExecutionStatus)
+	}
+	return jeses, nil
+}
 
-	client := controller.NewControllerClient(conn)
+func (ac *Client) GetRunStatus(ctx context.Context) (*controller.RunStatus, error) {
+	client := controller.NewControllerClient(ac.conn)
 
 	status, err := client.Status(ctx, &empty.Empty{})
 	if err != nil {
@@ -82,3 +93,67 @@ func (ac Client) GetRunStatus(ctx context.Context) (*controller.RunStatus, error
 		return &status.RunStatus, nil
 	}
 }
+
+// ListConfigObjects returns the config objects of the given kind. If ids are
+// given only the objects with those ids are returned.
+func (ac *Client) ListConfigObjects(ctx context.Context, kind config.Kind, ids ...string) ([]*config.ConfigObject, error) {
+	client := config.NewConfigClient(ac.conn)
+
+	req := &config.ListRequest{
+		Kind: kind,
+		Id:   ids,
+	}
+
+	stream, err := client.ListConfigObjects(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list config objects: %w", err)
+	}
+	var objects []*config.ConfigObject
+	for {
+		object, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// ListRecentCrawlLogs returns the crawl logs newer than since, newest first.
+// At most max crawl logs are returned.
+func (ac *Client) ListRecentCrawlLogs(ctx context.Context, since time.Time, max int) ([]*frontier.CrawlLog, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	client := report.NewReportClient(ac.conn)
+
+	req := &report.CrawlLogListRequest{
+		OrderByPath:     "timeStamp",
+		OrderDescending: true,
+		PageSize:        int32(max),
+	}
+
+	stream, err := client.ListCrawlLogs(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list crawl logs: %w", err)
+	}
+	var crawlLogs []*frontier.CrawlLog
+	for len(crawlLogs) < max {
+		crawlLog, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list crawl logs: %w", err)
+		}
+		timeStamp, err := ptypes.Timestamp(crawlLog.GetTimeStamp())
+		if err == nil && timeStamp.Before(since) {
+			break
+		}
+		crawlLogs = append(crawlLogs, crawlLog)
+	}
+	return crawlLogs, nil
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/grpc/credentials"
+)
+
+type TLSOptions struct {
+	// Enabled enables transport security. It is implied by CACert and ClientCert.
+	Enabled bool
+	// CACert is the path to a PEM encoded CA bundle used to verify the server.
+	// If empty the system roots are used.
+	CACert string
+	// ServerNameOverride overrides the server name used to verify the server certificate.
+	ServerNameOverride string
+	// ClientCert and ClientKey are paths to a PEM encoded client certificate and key
+	// used for mutual TLS.
+	ClientCert string
+	ClientKey  string
+}
+
+func (o TLSOptions) enabled() bool {
+	return o.Enabled || o.CACert != "" || o.ClientCert != ""
+}
+
+// transportCredentials returns TLS transport credentials configured by options.
+func transportCredentials(options TLSOptions) (credentials.TransportCredentials, error) {
+	config := &tls.Config{
+		ServerName: options.ServerNameOverride,
+	}
+
+	if options.CACert != "" {
+		pem, err := ioutil.ReadFile(options.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", options.CACert)
+		}
+		config.RootCAs = pool
+	}
+
+	if options.ClientCert != "" || options.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(options.ClientCert, options.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(config), nil
+}
@@ -1,5 +1,16 @@
 package grpc
 
+// Service is a gRPC service whose health is checked with the standard gRPC health checking protocol.
+type Service struct {
+	// Name is the name the service is reported as.
+	Name string `mapstructure:"name"`
+	// Address is the address in the form "host:port". If empty the Veidemann API URL is used.
+	Address string `mapstructure:"address"`
+	// Service is the service name sent in the health check request. If empty the
+	// overall health of the server is checked.
+	Service string `mapstructure:"service"`
+}
+
 type Options struct {
 	VeidemannApiUrl string
 }
@@ -1 +1,37 @@
 package grpc
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type Query interface {
+	CheckHealth(ctx context.Context, service Service) (grpc_health_v1.HealthCheckResponse_ServingStatus, error)
+}
+
+// CheckHealth checks the health of a service using the grpc.health.v1.Health service.
+func (c Client) CheckHealth(ctx context.Context, service Service) (grpc_health_v1.HealthCheckResponse_ServingStatus, error) {
+	address := service.Address
+	if address == "" {
+		address = c.veidemannApiUrl
+	}
+
+	conn, err := grpc.DialContext(ctx, address, grpc.WithInsecure())
+	if err != nil {
+		return grpc_health_v1.HealthCheckResponse_UNKNOWN, fmt.Errorf("failed to dial %s: %w", address, err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	resp, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service.Service})
+	if err != nil {
+		return grpc_health_v1.HealthCheckResponse_UNKNOWN, fmt.Errorf("failed to check health of %s: %w", address, err)
+	}
+	return resp.GetStatus(), nil
+}
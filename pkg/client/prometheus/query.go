@@ -3,6 +3,7 @@ package prometheus
 import (
 	"context"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/prometheus/common/model"
@@ -10,6 +11,7 @@ import (
 
 type Query interface {
 	IsActivity(ctx context.Context) (bool, error)
+	QueryValue(ctx context.Context, query string) (float64, error)
 }
 
 func (pc Client) IsActivity(ctx context.Context) (bool, error) {
@@ -28,3 +30,31 @@ func (pc Client) IsActivity(ctx context.Context) (bool, error) {
 		return false, nil
 	}
 }
+
+// QueryValue evaluates a PromQL expression and returns its value. The expression
+// must evaluate to a scalar or to a vector with exactly one sample, and the
+// value must be a finite number.
+func (pc Client) QueryValue(ctx context.Context, query string) (float64, error) {
+	value, _, err := pc.Query(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var v float64
+	switch value.Type() {
+	case model.ValScalar:
+		v = float64(value.(*model.Scalar).Value)
+	case model.ValVector:
+		vector := value.(model.Vector)
+		if len(vector) != 1 {
+			return 0, fmt.Errorf("expected vector to have exactly one sample, got %d", len(vector))
+		}
+		v = float64(vector[0].Value)
+	default:
+		return 0, fmt.Errorf("unsupported value type: %s", value.Type())
+	}
+	// NaN and infinities can't be encoded as JSON
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("expected a finite number, got %v", v)
+	}
+	return v, nil
+}
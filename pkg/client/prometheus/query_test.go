@@ -0,0 +1,52 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestServer returns a Prometheus API server that responds to every query with data.
+func newTestServer(data string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":` + data + `}`))
+	}))
+}
+
+func TestQueryValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		value float64
+		ok    bool
+	}{
+		{"scalar", `{"resultType":"scalar","result":[1614585600,"42.5"]}`, 42.5, true},
+		{"single sample", `{"resultType":"vector","result":[{"metric":{},"value":[1614585600,"7"]}]}`, 7, true},
+		{"no samples", `{"resultType":"vector","result":[]}`, 0, false},
+		{"two samples", `{"resultType":"vector","result":[{"metric":{"a":"1"},"value":[1614585600,"1"]},{"metric":{"a":"2"},"value":[1614585600,"2"]}]}`, 0, false},
+		{"matrix", `{"resultType":"matrix","result":[]}`, 0, false},
+		{"NaN", `{"resultType":"scalar","result":[1614585600,"NaN"]}`, 0, false},
+		{"NaN sample", `{"resultType":"vector","result":[{"metric":{},"value":[1614585600,"NaN"]}]}`, 0, false},
+		{"infinity", `{"resultType":"scalar","result":[1614585600,"+Inf"]}`, 0, false},
+		{"negative infinity", `{"resultType":"scalar","result":[1614585600,"-Inf"]}`, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(test.data)
+			defer server.Close()
+
+			value, err := New(Options{Address: server.URL}).QueryValue(context.Background(), "x")
+			if test.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Fatalf("expected error, got %v", value)
+			}
+			if value != test.value {
+				t.Errorf("expected %v, got %v", test.value, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+// Package events streams health changes to clients as Server-Sent Events.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+)
+
+type Options struct {
+	// BufferSize is the number of events kept for clients resuming with Last-Event-ID.
+	BufferSize int
+	// Keepalive is the interval between keepalive comments sent to idle clients.
+	Keepalive time.Duration
+}
+
+// events queued per client before a slow client is disconnected
+const clientQueueSize = 64
+
+// Change is the data of an event sent when the status or an observed value of
+// a component changes.
+type Change struct {
+	ComponentId string      `json:"componentId"`
+	Status      api.Status  `json:"status"`
+	Checks      []api.Check `json:"checks"`
+}
+
+type event struct {
+	id   uint64
+	name string
+	data []byte
+}
+
+func (e *event) writeTo(w http.ResponseWriter) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.id, e.name, e.data)
+	return err
+}
+
+// Broker turns check results into events and sends them to connected clients.
+type Broker struct {
+	options  Options
+	snapshot func() *api.Health
+
+	// signatures of the last observed status and values of every component
+	signatures map[string]string
+
+	mu      sync.Mutex
+	lastId  uint64
+	buffer  []*event
+	clients map[chan *event]struct{}
+	done    chan struct{}
+}
+
+// New creates a new broker. snapshot returns the health sent to clients when
+// they connect.
+func New(options Options, snapshot func() *api.Health) (*Broker, error) {
+	if options.BufferSize <= 0 {
+		return nil, fmt.Errorf("event buffer size must be positive: %d", options.BufferSize)
+	}
+	if options.Keepalive <= 0 {
+		return nil, fmt.Errorf("event keepalive interval must be positive: %v", options.Keepalive)
+	}
+	return &Broker{
+		options:    options,
+		snapshot:   snapshot,
+		signatures: make(map[string]string),
+		clients:    make(map[chan *event]struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// signature returns a string that changes when the status or an observed value changes.
+func signature(checks []api.Check) string {
+	type checkSignature struct {
+		Id     string
+		Status api.Status
+		Value  api.Value
+	}
+	var signatures []checkSignature
+	for _, check := range checks {
+		signatures = append(signatures, checkSignature{check.ComponentId, check.Status, check.ObservedValue})
+	}
+	b, _ := json.Marshal(signatures)
+	return string(b)
+}
+
+// Observe publishes an event if the status or an observed value of the
+// component has changed. Calls to Observe must be serialized.
+func (b *Broker) Observe(checkResult *healthcheck.CheckResult) {
+	checks := healthcheck.ToChecks(checkResult)
+	s := signature(checks)
+	if previous, ok := b.signatures[checkResult.Name]; ok && previous == s {
+		return
+	}
+	b.signatures[checkResult.Name] = s
+
+	data, err := json.Marshal(Change{
+		ComponentId: checkResult.Name,
+		Status:      healthcheck.ComponentStatus(checkResult),
+		Checks:      checks,
+	})
+	if err != nil {
+		log.Printf("failed to marshal event: %v", err)
+		return
+	}
+	b.publish("change", data)
+}
+
+func (b *Broker) publish(name string, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastId++
+	e := &event{id: b.lastId, name: name, data: data}
+	b.buffer = append(b.buffer, e)
+	if len(b.buffer) > b.options.BufferSize {
+		b.buffer = b.buffer[len(b.buffer)-b.options.BufferSize:]
+	}
+	for client := range b.clients {
+		select {
+		case client <- e:
+		default:
+			// the client can't keep up, it may reconnect and resume from the buffer
+			delete(b.clients, client)
+			close(client)
+		}
+	}
+}
+
+// subscribe registers a client. If lastEventId is in the buffer, the events
+// after it are returned for replay. Otherwise replay is false and the client
+// should be sent a snapshot.
+func (b *Broker) subscribe(lastEventId string) (client chan *event, missed []*event, replay bool, id uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	client = make(chan *event, clientQueueSize)
+	b.clients[client] = struct{}{}
+
+	if last, err := strconv.ParseUint(lastEventId, 10, 64); err == nil && last <= b.lastId {
+		if last == b.lastId {
+			return client, nil, true, b.lastId
+		}
+		if len(b.buffer) > 0 && b.buffer[0].id <= last+1 {
+			for _, e := range b.buffer {
+				if e.id > last {
+					missed = append(missed, e)
+				}
+			}
+			return client, missed, true, b.lastId
+		}
+	}
+	return client, nil, false, b.lastId
+}
+
+func (b *Broker) unsubscribe(client chan *event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.clients[client]; ok {
+		delete(b.clients, client)
+		close(client)
+	}
+}
+
+// Close disconnects all clients.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+}
+
+// Handler returns a handler that streams events. A client is first sent a
+// snapshot event with the full health, or the missed events if it resumes
+// with the Last-Event-ID header, followed by a change event every time the
+// status or an observed value of a component changes.
+func (b *Broker) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		client, missed, replay, id := b.subscribe(r.Header.Get("Last-Event-ID"))
+		defer b.unsubscribe(client)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		if replay {
+			for _, e := range missed {
+				if err := e.writeTo(w); err != nil {
+					return
+				}
+			}
+		} else {
+			data, err := json.Marshal(b.snapshot())
+			if err != nil {
+				log.Printf("failed to marshal snapshot: %v", err)
+				return
+			}
+			// the snapshot includes all changes up to the current event id
+			snapshot := &event{id: id, name: "snapshot", data: data}
+			if err := snapshot.writeTo(w); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		keepalive := time.NewTicker(b.options.Keepalive)
+		defer keepalive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-b.done:
+				return
+			case e, ok := <-client:
+				if !ok {
+					return
+				}
+				if err := e.writeTo(w); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-keepalive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+)
+
+// frame is an event or a comment read from an event stream.
+type frame struct {
+	id      string
+	name    string
+	data    string
+	comment string
+}
+
+// stream is a client connected to the event stream.
+type stream struct {
+	t      *testing.T
+	cancel context.CancelFunc
+	reader *bufio.Reader
+}
+
+// connect connects to the event stream of server, resuming from lastEventId if it is not empty.
+func connect(t *testing.T, server *httptest.Server, lastEventId string) *stream {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response: %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	return &stream{t: t, cancel: cancel, reader: bufio.NewReader(resp.Body)}
+}
+
+func (s *stream) close() {
+	s.cancel()
+}
+
+// next reads the next frame from the stream.
+func (s *stream) next() frame {
+	s.t.Helper()
+	var f frame
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			s.t.Fatalf("failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return f
+		}
+		if strings.HasPrefix(line, ":") {
+			f.comment = strings.TrimSpace(line[1:])
+			continue
+		}
+		field := strings.SplitN(line, ": ", 2)
+		switch field[0] {
+		case "id":
+			f.id = field[1]
+		case "event":
+			f.name = field[1]
+		case "data":
+			f.data = field[1]
+		}
+	}
+}
+
+// expect reads the next frame and fails the test if it is not an event with id and name.
+func (s *stream) expect(id uint64, name string) frame {
+	s.t.Helper()
+	f := s.next()
+	if f.id != strconv.FormatUint(id, 10) || f.name != name {
+		s.t.Fatalf("expected %s event %d, got %+v", name, id, f)
+	}
+	return f
+}
+
+func newTestBroker(t *testing.T, options Options) (*Broker, *httptest.Server) {
+	t.Helper()
+	b, err := New(options, func() *api.Health {
+		return &api.Health{Status: api.StatusHealthy}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, httptest.NewServer(b.Handler())
+}
+
+// observe observes a result of the dashboard component with value.
+func observe(b *Broker, value int) {
+	b.Observe(&healthcheck.CheckResult{
+		Name:    healthcheck.VeidemannDashboard,
+		Results: []*healthcheck.Result{{Status: healthcheck.StatusPass, Value: value}},
+		Time:    time.Now(),
+	})
+}
+
+func TestSnapshotAndChanges(t *testing.T) {
+	b, server := newTestBroker(t, Options{BufferSize: 10, Keepalive: time.Hour})
+	defer server.Close()
+	defer b.Close()
+
+	observe(b, 1)
+	s := connect(t, server, "")
+	defer s.close()
+
+	snapshot := s.expect(1, "snapshot")
+	var health api.Health
+	if err := json.Unmarshal([]byte(snapshot.data), &health); err != nil || health.Status != api.StatusHealthy {
+		t.Errorf("unexpected snapshot: %s", snapshot.data)
+	}
+
+	// an unchanged result is not published
+	observe(b, 1)
+	observe(b, 2)
+	change := s.expect(2, "change")
+	var c Change
+	if err := json.Unmarshal([]byte(change.data), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.ComponentId != healthcheck.VeidemannDashboard || c.Status != api.StatusHealthy ||
+		len(c.Checks) != 1 || c.Checks[0].ObservedValue != 2.0 {
+		t.Errorf("unexpected change: %s", change.data)
+	}
+}
+
+func TestResume(t *testing.T) {
+	b, server := newTestBroker(t, Options{BufferSize: 10, Keepalive: time.Hour})
+	defer server.Close()
+	defer b.Close()
+
+	for i := 1; i <= 3; i++ {
+		observe(b, i)
+	}
+
+	// the missed events are replayed instead of a snapshot
+	s := connect(t, server, "1")
+	defer s.close()
+	s.expect(2, "change")
+	s.expect(3, "change")
+
+	// a client that is up to date gets nothing until the next change
+	upToDate := connect(t, server, "3")
+	defer upToDate.close()
+	observe(b, 4)
+	upToDate.expect(4, "change")
+	s.expect(4, "change")
+}
+
+func TestResumeFromTrimmedEvent(t *testing.T) {
+	b, server := newTestBroker(t, Options{BufferSize: 2, Keepalive: time.Hour})
+	defer server.Close()
+	defer b.Close()
+
+	for i := 1; i <= 5; i++ {
+		observe(b, i)
+	}
+
+	// event 2 was trimmed from the buffer, so the client can't resume and
+	// gets a snapshot of the current health instead
+	for _, lastEventId := range []string{"1", "2", "6", "invalid"} {
+		s := connect(t, server, lastEventId)
+		s.expect(5, "snapshot")
+		s.close()
+	}
+
+	// the events after event 3 are still in the buffer
+	s := connect(t, server, "3")
+	defer s.close()
+	s.expect(4, "change")
+	s.expect(5, "change")
+}
+
+func TestSlowClientIsDisconnected(t *testing.T) {
+	b, err := New(Options{BufferSize: 2 * clientQueueSize, Keepalive: time.Hour}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a client that doesn't read its events
+	client, _, _, _ := b.subscribe("")
+	for i := 1; i <= clientQueueSize+1; i++ {
+		observe(b, i)
+	}
+
+	var received []*event
+	for e := range client {
+		received = append(received, e)
+	}
+	if len(received) != clientQueueSize {
+		t.Errorf("expected %d events before the client was disconnected, got %d", clientQueueSize, len(received))
+	}
+	if len(b.clients) != 0 {
+		t.Errorf("expected the client to be unsubscribed")
+	}
+	// unsubscribing a disconnected client must not close its channel again
+	b.unsubscribe(client)
+
+	// the client can resume from the last event it received
+	client, missed, replay, _ := b.subscribe(strconv.FormatUint(received[len(received)-1].id, 10))
+	defer b.unsubscribe(client)
+	if !replay || len(missed) != 1 || missed[0].id != clientQueueSize+1 {
+		t.Errorf("expected to replay event %d, got %v %v", clientQueueSize+1, replay, missed)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	b, server := newTestBroker(t, Options{BufferSize: 10, Keepalive: 10 * time.Millisecond})
+	defer server.Close()
+	defer b.Close()
+
+	s := connect(t, server, "")
+	defer s.close()
+	s.expect(0, "snapshot")
+	for i := 0; i < 2; i++ {
+		if f := s.next(); f.comment != "keepalive" || f.id != "" {
+			t.Errorf("expected keepalive, got %+v", f)
+		}
+	}
+
+	// events are sent between keepalives
+	observe(b, 1)
+	for {
+		f := s.next()
+		if f.comment == "keepalive" {
+			continue
+		}
+		if f.id != "1" || f.name != "change" {
+			t.Errorf("expected change event 1, got %+v", f)
+		}
+		break
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, options := range []Options{
+		{Keepalive: time.Second},
+		{BufferSize: 10},
+		{BufferSize: -1, Keepalive: time.Second},
+	} {
+		if _, err := New(options, nil); err == nil {
+			t.Errorf("expected error for %+v", options)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package healthcheck
+
+import (
+	"time"
+
+	controllerApi "github.com/nlnwa/veidemann-api-go/controller/v1"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+)
+
+var statusToApi = map[Status]api.Status{
+	StatusPass:    api.StatusHealthy,
+	StatusWarning: api.StatusWarn,
+	StatusFail:    api.StatusUnhealthy,
+}
+
+// ToApiStatus converts a check status to a status of the health API.
+func ToApiStatus(status Status) api.Status {
+	return statusToApi[status]
+}
+
+// Aggregate returns a new health document based on base with the check results
+// passed by collect to its observer. The status of the document is the worst
+// status of the checks.
+//
+// Base is not modified, so a base document can be shared between concurrent calls.
+func Aggregate(base api.Health, collect func(checkObserver)) *api.Health {
+	health := base
+	health.Status = api.StatusHealthy
+	health.Checks = make(api.Checks)
+
+	collect(func(checkResult *CheckResult) {
+		checks := ToChecks(checkResult)
+		health.Status = worst(health.Status, checks)
+		health.Checks[checkResult.Name] = checks
+	})
+
+	return &health
+}
+
+// Filtered returns a function like collect that applies filter to every result
+// before it is passed to the observer.
+func Filtered(collect func(checkObserver), filter func(*CheckResult) *CheckResult) func(checkObserver) {
+	return func(observer checkObserver) {
+		collect(func(checkResult *CheckResult) {
+			observer(filter(checkResult))
+		})
+	}
+}
+
+// ComponentStatus returns the worst status of the results of a component.
+// Results with undefined status don't count, so a component without results
+// with defined status is healthy.
+func ComponentStatus(checkResult *CheckResult) api.Status {
+	return worst(api.StatusHealthy, ToChecks(checkResult))
+}
+
+func worst(status api.Status, checks []api.Check) api.Status {
+	for _, check := range checks {
+		if check.Status.Value() > 0 && check.Status.Value() < status.Value() {
+			status = check.Status
+		}
+	}
+	return status
+}
+
+// ToChecks converts the results of a component to checks of the health API.
+func ToChecks(checkResult *CheckResult) []api.Check {
+	var checks []api.Check
+	for _, result := range checkResult.Results {
+		check := api.Check{
+			Time:              api.FormatTime(result.Time),
+			Age:               time.Since(result.Time).Round(time.Millisecond).String(),
+			Stale:             checkResult.Stale,
+			ComponentType:     result.Type,
+			ComponentId:       result.Id,
+			Status:            ToApiStatus(result.Status),
+			ObservedUnit:      result.Unit,
+			ObservedValue:     result.Value,
+			AffectedEndpoints: result.Endpoints,
+			Links:             result.Links,
+			Description:       result.Description,
+		}
+		// the run status of the crawler is reported by name
+		if runStatus, ok := result.Value.(controllerApi.RunStatus); ok {
+			check.ObservedValue = runStatus.String()
+		}
+		if result.Err != nil {
+			check.Output = result.Err.Error()
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
@@ -0,0 +1,154 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CrawlLogOptions configures the crawl log error rate check.
+type CrawlLogOptions struct {
+	// Window is how far back in the crawl log the check looks.
+	Window time.Duration
+	// MaxEntries is the maximum number of crawl log entries read per check.
+	MaxEntries int
+	// WarnRate is the error rate in percent above which the check warns.
+	WarnRate float64
+	// FailRate is the error rate in percent above which the check fails.
+	FailRate float64
+}
+
+// names of the error codes of failed fetches
+var crawlLogErrorNames = map[int32]string{
+	-1:    "dnsLookupFailed",
+	-2:    "connectFailed",
+	-3:    "connectBroken",
+	-4:    "httpTimeout",
+	-5:    "runtimeException",
+	-6:    "domainLookupFailed",
+	-7:    "invalidUri",
+	-8:    "retryLimitReached",
+	-9:    "unfetchableUri",
+	-50:   "temporaryError",
+	-60:   "outOfScope",
+	-61:   "tooManyHops",
+	-62:   "tooManyTransitiveHops",
+	-63:   "blockedByPolicy",
+	-404:  "emptyResponse",
+	-4000: "chaffDetected",
+	-4001: "tooManyPathRepetitions",
+	-4002: "tooManyPathSegments",
+	-5000: "blockedByCustomProcessor",
+	-5001: "blockedMixedContent",
+	-5002: "blockedMixedContentLoop",
+	-5003: "prerequisiteFailed",
+	-5004: "precludedByPolicy",
+	-9998: "deniedByRobots",
+}
+
+// isCrawlLogPolicyCode reports whether code means the URI was not fetched
+// because of the scope or the policy of the crawl rather than a fetch error.
+func isCrawlLogPolicyCode(code int32) bool {
+	return code <= -60 && code >= -63 || code <= -5000
+}
+
+func crawlLogErrorName(code int32) string {
+	if name, ok := crawlLogErrorNames[code]; ok {
+		return name
+	}
+	return strconv.Itoa(int(code))
+}
+
+// crawlLogComponent returns a component that checks the share of recent
+// fetches that ended in error. The first result is the overall error rate,
+// followed by one result per error code. URIs that were not fetched because
+// of the scope or the policy of the crawl are not counted.
+func (hc *HealthChecker) crawlLogComponent(options CrawlLogOptions) (component, error) {
+	if options.Window <= 0 {
+		return component{}, fmt.Errorf("crawl log window must be positive")
+	}
+	if options.MaxEntries <= 0 {
+		return component{}, fmt.Errorf("crawl log max entries must be positive")
+	}
+
+	return component{
+		id: VeidemannCrawlLogErrors,
+		checkers: []checker{
+			func(ctx context.Context, _ Results) []*Result {
+				result := &Result{
+					Description: fmt.Sprintf("check error rate of fetches the last %s", options.Window),
+					Type:        "harvester",
+					Unit:        "%",
+					Time:        hc.now(),
+				}
+				crawlLogs, err := hc.controllerClient.ListRecentCrawlLogs(ctx, result.Time.Add(-options.Window), options.MaxEntries)
+				if err != nil {
+					result.Err = err
+					result.Status = StatusWarning
+					return []*Result{result}
+				}
+
+				failures := make(map[int32]int)
+				fetches := 0
+				total := 0
+				for _, crawlLog := range crawlLogs {
+					code := crawlLog.GetStatusCode()
+					if crawlLog.GetError() != nil {
+						code = crawlLog.GetError().GetCode()
+					}
+					if isCrawlLogPolicyCode(code) {
+						continue
+					}
+					fetches++
+					if crawlLog.GetError() != nil || code < 0 {
+						failures[code]++
+						total++
+					}
+				}
+				if fetches == 0 {
+					result.Value = 0.0
+					result.Status = StatusPass
+					return []*Result{result}
+				}
+
+				rate := percent(total, fetches)
+				result.Value = rate
+				if options.FailRate > 0 && rate > options.FailRate {
+					result.Status = StatusFail
+				} else if options.WarnRate > 0 && rate > options.WarnRate {
+					result.Status = StatusWarning
+				} else {
+					result.Status = StatusPass
+				}
+				if result.Status != StatusPass {
+					result.Err = fmt.Errorf("%d of %d fetches failed", total, fetches)
+				}
+
+				var codes []int
+				for code := range failures {
+					codes = append(codes, int(code))
+				}
+				sort.Ints(codes)
+
+				results := []*Result{result}
+				for _, code := range codes {
+					results = append(results, &Result{
+						Id:          crawlLogErrorName(int32(code)),
+						Description: fmt.Sprintf("share of fetches that failed with error code %d", code),
+						Type:        "harvester",
+						Unit:        "%",
+						Time:        result.Time,
+						Value:       percent(failures[int32(code)], fetches),
+					})
+				}
+				return results
+			},
+		},
+	}, nil
+}
+
+func percent(n, total int) float64 {
+	return float64(n) * 100 / float64(total)
+}
@@ -0,0 +1,151 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	commons "github.com/nlnwa/veidemann-api-go/commons/v1"
+	"github.com/nlnwa/veidemann-api-go/frontier/v1"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/controller"
+)
+
+// crawlLogController is a fake controller with crawl logs.
+type crawlLogController struct {
+	controller.Query
+	crawlLogs []*frontier.CrawlLog
+	err       error
+	since     time.Time
+	max       int
+}
+
+func (c *crawlLogController) ListRecentCrawlLogs(_ context.Context, since time.Time, max int) ([]*frontier.CrawlLog, error) {
+	c.since = since
+	c.max = max
+	return c.crawlLogs, c.err
+}
+
+// crawlLogs returns n crawl logs with status code.
+func crawlLogs(n int, statusCode int32) []*frontier.CrawlLog {
+	var crawlLogs []*frontier.CrawlLog
+	for i := 0; i < n; i++ {
+		crawlLogs = append(crawlLogs, &frontier.CrawlLog{StatusCode: statusCode})
+	}
+	return crawlLogs
+}
+
+// crawlLogErrors returns n crawl logs with error code.
+func crawlLogErrors(n int, code int32) []*frontier.CrawlLog {
+	var crawlLogs []*frontier.CrawlLog
+	for i := 0; i < n; i++ {
+		crawlLogs = append(crawlLogs, &frontier.CrawlLog{Error: &commons.Error{Code: code}})
+	}
+	return crawlLogs
+}
+
+func concat(crawlLogs ...[]*frontier.CrawlLog) []*frontier.CrawlLog {
+	var all []*frontier.CrawlLog
+	for _, c := range crawlLogs {
+		all = append(all, c...)
+	}
+	return all
+}
+
+func TestCrawlLogComponent(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	options := CrawlLogOptions{Window: 5 * time.Minute, MaxEntries: 1000, WarnRate: 10, FailRate: 50}
+
+	type code struct {
+		id   string
+		rate float64
+	}
+	tests := []struct {
+		name      string
+		options   CrawlLogOptions
+		crawlLogs []*frontier.CrawlLog
+		err       error
+		status    Status
+		rate      Value
+		codes     []code
+	}{
+		{"no fetches", options, nil, nil, StatusPass, 0.0, nil},
+		{"no errors", options, crawlLogs(10, 200), nil, StatusPass, 0.0, nil},
+		{"below warn rate", options, concat(crawlLogs(19, 200), crawlLogs(1, 404), crawlLogs(1, -1)), nil, StatusPass, 100.0 / 21, []code{
+			{"dnsLookupFailed", 100.0 / 21},
+		}},
+		{"warn", options, concat(crawlLogs(7, 200), crawlLogs(2, -1), crawlLogErrors(1, -4)), nil, StatusWarning, 30.0, []code{
+			{"httpTimeout", 10},
+			{"dnsLookupFailed", 20},
+		}},
+		{"fail", options, concat(crawlLogs(2, 200), crawlLogs(6, -2), crawlLogErrors(1, -404), crawlLogErrors(1, -42)), nil, StatusFail, 80.0, []code{
+			{"emptyResponse", 10},
+			{"-42", 10},
+			{"connectFailed", 60},
+		}},
+		{"thresholds disabled", CrawlLogOptions{Window: time.Minute, MaxEntries: 10}, crawlLogs(1, -2), nil, StatusPass, 100.0, []code{
+			{"connectFailed", 100},
+		}},
+		{"policy codes are not fetches", options, concat(
+			crawlLogs(4, 200),
+			crawlLogs(3, -60),
+			crawlLogs(1, -61),
+			crawlLogs(1, -62),
+			crawlLogErrors(1, -63),
+			crawlLogs(2, -5000),
+			crawlLogErrors(2, -5004),
+			crawlLogErrors(1, -9998),
+		), nil, StatusPass, 0.0, nil},
+		{"only policy codes", options, concat(crawlLogs(3, -60), crawlLogs(1, -9998)), nil, StatusPass, 0.0, nil},
+		{"errors among policy codes", options, concat(crawlLogs(3, 200), crawlLogs(1, -3), crawlLogs(6, -61), crawlLogs(1, -64)), nil, StatusWarning, 40.0, []code{
+			{"-64", 20},
+			{"connectBroken", 20},
+		}},
+		{"controller error", options, nil, errors.New("unavailable"), StatusWarning, nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &crawlLogController{crawlLogs: test.crawlLogs, err: test.err}
+			hc := &HealthChecker{controllerClient: fake, now: func() time.Time { return now }}
+			c, err := hc.crawlLogComponent(test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results := c.checkers[0](context.Background(), nil)
+
+			if !fake.since.Equal(now.Add(-test.options.Window)) || fake.max != test.options.MaxEntries {
+				t.Errorf("expected crawl logs since %v (at most %d), got since %v (at most %d)",
+					now.Add(-test.options.Window), test.options.MaxEntries, fake.since, fake.max)
+			}
+			result := results[0]
+			if result.Status != test.status || result.Value != test.rate || !result.Time.Equal(now) {
+				t.Errorf("expected %v with rate %v, got %v with rate %v", test.status, test.rate, result.Status, result.Value)
+			}
+			if (result.Err != nil) != (test.status != StatusPass) {
+				t.Errorf("unexpected error: %v", result.Err)
+			}
+			if len(results)-1 != len(test.codes) {
+				t.Fatalf("expected %d error codes, got %d", len(test.codes), len(results)-1)
+			}
+			for i, code := range test.codes {
+				r := results[i+1]
+				if r.Id != code.id || r.Value != code.rate || r.Unit != "%" {
+					t.Errorf("expected %s with rate %v, got %s with rate %v", code.id, code.rate, r.Id, r.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestCrawlLogComponentErrors(t *testing.T) {
+	hc := &HealthChecker{}
+	for _, options := range []CrawlLogOptions{
+		{MaxEntries: 1000},
+		{Window: time.Minute},
+		{Window: -time.Minute, MaxEntries: 1000},
+	} {
+		if _, err := hc.crawlLogComponent(options); err == nil {
+			t.Errorf("expected error for %+v", options)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// grpcComponent returns a component that checks the health of a gRPC service
+// using the gRPC health checking protocol.
+func (hc *HealthChecker) grpcComponent(service grpc.Service) (component, error) {
+	if service.Name == "" {
+		return component{}, fmt.Errorf("gRPC health service is missing name")
+	}
+
+	return component{
+		id: "veidemann:" + service.Name,
+		checkers: []checker{
+			single(func(ctx context.Context, _ Results) *Result {
+				result := &Result{
+					Description: "check health of " + service.Name + " service",
+					Type:        "grpc",
+					Time:        time.Now(),
+				}
+				servingStatus, err := hc.grpcClient.CheckHealth(ctx, service)
+				if err != nil {
+					result.Err = err
+					switch status.Code(errors.Unwrap(err)) {
+					case codes.Unimplemented, codes.NotFound:
+						// server is up but doesn't report the health of the service
+						result.Status = StatusWarning
+					default:
+						result.Status = StatusFail
+					}
+					return result
+				}
+				result.Value = servingStatus.String()
+				switch servingStatus {
+				case grpc_health_v1.HealthCheckResponse_SERVING:
+					result.Status = StatusPass
+				case grpc_health_v1.HealthCheckResponse_NOT_SERVING:
+					result.Status = StatusFail
+				default:
+					result.Status = StatusWarning
+				}
+				return result
+			}),
+		},
+	}, nil
+}
@@ -0,0 +1,96 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	grpcClient "github.com/nlnwa/veidemann-health-check-api/pkg/client/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startGrpcServer starts a local gRPC server. If healthServer is nil the
+// server does not implement the health checking protocol.
+func startGrpcServer(t *testing.T, healthServer *health.Server) (string, func()) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	if healthServer != nil {
+		grpc_health_v1.RegisterHealthServer(server, healthServer)
+	}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return listener.Addr().String(), server.Stop
+}
+
+func TestGrpcComponent(t *testing.T) {
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("serving", grpc_health_v1.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("notServing", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	address, stop := startGrpcServer(t, healthServer)
+	defer stop()
+
+	unimplementedAddress, stopUnimplemented := startGrpcServer(t, nil)
+	defer stopUnimplemented()
+
+	hc := &HealthChecker{grpcClient: grpcClient.New(grpcClient.Options{VeidemannApiUrl: address})}
+
+	tests := []struct {
+		name    string
+		service grpcClient.Service
+		status  Status
+		value   Value
+	}{
+		{"serving", grpcClient.Service{Name: "frontier", Service: "serving"}, StatusPass, "SERVING"},
+		{"not serving", grpcClient.Service{Name: "frontier", Service: "notServing"}, StatusFail, "NOT_SERVING"},
+		{"server", grpcClient.Service{Name: "frontier", Address: address}, StatusPass, "SERVING"},
+		{"unknown service", grpcClient.Service{Name: "frontier", Service: "unknown"}, StatusWarning, nil},
+		{"unimplemented", grpcClient.Service{Name: "frontier", Address: unimplementedAddress}, StatusWarning, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := hc.grpcComponent(test.service)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.id != "veidemann:frontier" {
+				t.Errorf("expected id veidemann:frontier, got %s", c.id)
+			}
+			result := c.checkers[0](context.Background(), nil)[0]
+			if result.Status != test.status {
+				t.Errorf("expected status %v, got %v (%v)", test.status, result.Status, result.Err)
+			}
+			if result.Value != test.value {
+				t.Errorf("expected value %v, got %v", test.value, result.Value)
+			}
+		})
+	}
+}
+
+func TestGrpcComponentUnavailable(t *testing.T) {
+	address, stop := startGrpcServer(t, health.NewServer())
+	stop()
+
+	hc := &HealthChecker{grpcClient: grpcClient.New(grpcClient.Options{})}
+	c, err := hc.grpcComponent(grpcClient.Service{Name: "frontier", Address: address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := c.checkers[0](context.Background(), nil)[0]
+	if result.Status != StatusFail || result.Err == nil {
+		t.Errorf("expected failure, got status %v (%v)", result.Status, result.Err)
+	}
+}
+
+func TestGrpcComponentMissingName(t *testing.T) {
+	hc := &HealthChecker{}
+	if _, err := hc.grpcComponent(grpcClient.Service{}); err == nil {
+		t.Error("expected error for service without name")
+	}
+}
@@ -2,26 +2,90 @@ package healthcheck
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	controllerApi "github.com/nlnwa/veidemann-api-go/controller/v1"
 	"github.com/nlnwa/veidemann-health-check-api/pkg/client/controller"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/grpc"
 	"github.com/nlnwa/veidemann-health-check-api/pkg/client/prometheus"
 	"github.com/nlnwa/veidemann-health-check-api/pkg/client/web"
+	"google.golang.org/grpc/connectivity"
 )
 
 const (
-	VeidemannDashboard     string = "veidemann:dashboard"
-	VeidemannJobs          string = "veidemann:jobs"
-	VeidemannCrawlerStatus string = "veidemann:crawlerStatus"
-	VeidemannActivity      string = "veidemann:activity"
-	VeidemannHarvest       string = "veidemann:harvest"
+	VeidemannDashboard      string = "veidemann:dashboard"
+	VeidemannJobs           string = "veidemann:jobs"
+	VeidemannCrawlerStatus  string = "veidemann:crawlerStatus"
+	VeidemannActivity       string = "veidemann:activity"
+	VeidemannHarvest        string = "veidemann:harvest"
+	VeidemannController     string = "veidemann:controllerConnection"
+	VeidemannJobProgress    string = "veidemann:jobProgress"
+	VeidemannCrawlLogErrors string = "veidemann:crawlLogErrors"
+	VeidemannSchedule       string = "veidemann:schedule"
 )
 
 type Value interface {
 }
 
+// NumericValue returns value as a float64 if it is a number or a boolean.
+func NumericValue(value Value) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// NumericFields returns the fields of value that are numbers or booleans by
+// their JSON name if value is a struct, e.g. the counters of JobProgress.
+func NumericFields(value Value) (map[string]float64, bool) {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+	fields := make(map[string]float64)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if f, ok := NumericValue(v.Field(i).Interface()); ok {
+			fields[name] = f
+		}
+	}
+	return fields, true
+}
+
 type Status int
 
 const (
@@ -34,6 +98,8 @@ const (
 type CheckResult struct {
 	Name    string
 	Results []*Result
+	Time    time.Time
+	Stale   bool
 }
 
 type Result struct {
@@ -47,72 +113,268 @@ type Result struct {
 	Value       Value
 	Err         error
 	Description string
+	Duration    time.Duration
+}
+
+// Results maps component ids to the check results of the components.
+type Results map[string]*CheckResult
+
+// value returns the value of the first successful result of the component with the given id.
+func (r Results) value(id string) Value {
+	if checkResult := r[id]; checkResult != nil {
+		for _, result := range checkResult.Results {
+			if result.Err == nil {
+				return result.Value
+			}
+		}
+	}
+	return nil
 }
 
-type checker func(context.Context) *Result
+// crawlerPaused reports whether the crawler status component reported that the
+// crawler is paused or pausing.
+func (r Results) crawlerPaused() bool {
+	runStatus, ok := r.value(VeidemannCrawlerStatus).(controllerApi.RunStatus)
+	return ok && (runStatus == controllerApi.RunStatus_PAUSED || runStatus == controllerApi.RunStatus_PAUSE_REQUESTED)
+}
+
+// checker checks some aspect of a component. The results of the components the
+// component depends on are passed in deps.
+type checker func(ctx context.Context, deps Results) []*Result
+
+// single returns a checker that checks a single aspect of a component.
+func single(check func(ctx context.Context, deps Results) *Result) checker {
+	return func(ctx context.Context, deps Results) []*Result {
+		return []*Result{check(ctx, deps)}
+	}
+}
 
 type component struct {
-	id       string
-	checkers []checker
+	id        string
+	dependsOn []string
+	checkers  []checker
 }
 
 type checkObserver func(*CheckResult)
 
 type Options struct {
-	WebOptions web.Options
-	Controller controller.Options
-	Prometheus prometheus.Options
+	WebOptions       web.Options
+	Controller       controller.Options
+	CrawlLog         CrawlLogOptions
+	Schedule         ScheduleOptions
+	Prometheus       prometheus.Options
+	PrometheusChecks []PrometheusCheck
+	Grpc             grpc.Options
+	GrpcServices     []grpc.Service
 }
 
 type HealthChecker struct {
 	httpClient       web.Query
 	prometheusClient prometheus.Query
 	controllerClient controller.Query
+	grpcClient       grpc.Query
+	dashboardUrl     string
 	components       []component
+	// targets are the health checkers combined by this health checker
+	targets []*HealthChecker
+	// now returns the current time. It is replaced by a fake clock in tests.
+	now func() time.Time
 }
 
-func NewHealthChecker(options *Options) *HealthChecker {
+func NewHealthChecker(options *Options) (*HealthChecker, error) {
+	controllerClient, err := controller.New(options.Controller)
+	if err != nil {
+		return nil, err
+	}
 	hc := &HealthChecker{
 		httpClient:       web.New(options.WebOptions),
-		controllerClient: controller.New(options.Controller),
+		controllerClient: controllerClient,
 		prometheusClient: prometheus.New(options.Prometheus),
+		grpcClient:       grpc.New(options.Grpc),
+		dashboardUrl:     options.WebOptions.VeidemannDashboardUrl,
+		now:              time.Now,
 	}
 	hc.components = hc.getChecks()
-	return hc
+	crawlLogComponent, err := hc.crawlLogComponent(options.CrawlLog)
+	if err != nil {
+		_ = hc.Close()
+		return nil, err
+	}
+	hc.components = append(hc.components, crawlLogComponent)
+	scheduleComponent, err := hc.scheduleComponent(options.Schedule)
+	if err != nil {
+		_ = hc.Close()
+		return nil, err
+	}
+	hc.components = append(hc.components, scheduleComponent)
+	for _, check := range options.PrometheusChecks {
+		c, err := hc.prometheusComponent(check)
+		if err != nil {
+			_ = hc.Close()
+			return nil, err
+		}
+		hc.components = append(hc.components, c)
+	}
+	for _, service := range options.GrpcServices {
+		c, err := hc.grpcComponent(service)
+		if err != nil {
+			_ = hc.Close()
+			return nil, err
+		}
+		hc.components = append(hc.components, c)
+	}
+	if err := validateComponents(hc.components); err != nil {
+		_ = hc.Close()
+		return nil, err
+	}
+	return hc, nil
+}
+
+// Close closes the connections of the health checker.
+func (hc *HealthChecker) Close() error {
+	var err error
+	if closer, ok := hc.controllerClient.(io.Closer); ok {
+		err = closer.Close()
+	}
+	for _, target := range hc.targets {
+		if targetErr := target.Close(); targetErr != nil && err == nil {
+			err = targetErr
+		}
+	}
+	return err
 }
 
+// RunChecks runs the checkers of all components and calls observer with the
+// result of each component.
+//
+// Components run concurrently, except that a component is not run before the
+// components it depends on are done. Calls to observer are serialized.
 func (hc *HealthChecker) RunChecks(observer checkObserver) {
+	var mu sync.Mutex
+	results := make(Results)
+
+	done := make(map[string]chan struct{}, len(hc.components))
 	for _, component := range hc.components {
-		var checkResults []*Result
+		done[component.id] = make(chan struct{})
+	}
 
-		for _, checker := range component.checkers {
-			checkResults = append(checkResults, hc.runCheck(checker))
-		}
-		result := &CheckResult{
-			Name:    component.id,
-			Results: checkResults,
-		}
-		observer(result)
+	var wg sync.WaitGroup
+	for _, c := range hc.components {
+		wg.Add(1)
+		go func(c component) {
+			defer wg.Done()
+			defer close(done[c.id])
+
+			deps := make(Results, len(c.dependsOn))
+			for _, id := range c.dependsOn {
+				<-done[id]
+				mu.Lock()
+				deps[id] = results[id]
+				mu.Unlock()
+			}
+
+			result := hc.runComponent(c, deps)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[c.id] = result
+			observer(result)
+		}(c)
 	}
+	wg.Wait()
 }
 
-func (hc *HealthChecker) runCheck(checker checker) *Result {
+// runComponent runs the checkers of a component concurrently.
+func (hc *HealthChecker) runComponent(c component, deps Results) *CheckResult {
+	results := make([][]*Result, len(c.checkers))
+
+	var wg sync.WaitGroup
+	for i, check := range c.checkers {
+		wg.Add(1)
+		go func(i int, check checker) {
+			defer wg.Done()
+			results[i] = hc.runCheck(check, deps)
+		}(i, check)
+	}
+	wg.Wait()
+
+	var checkResults []*Result
+	for _, r := range results {
+		checkResults = append(checkResults, r...)
+	}
+
+	return &CheckResult{
+		Name:    c.id,
+		Results: checkResults,
+		Time:    time.Now(),
+	}
+}
+
+func (hc *HealthChecker) runCheck(checker checker, deps Results) []*Result {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
 	defer cancel()
-	return checker(ctx)
+	start := time.Now()
+	results := checker(ctx, deps)
+	duration := time.Since(start)
+	for _, result := range results {
+		result.Duration = duration
+	}
+	return results
+}
+
+// validateComponents returns an error if component ids are not unique, if a
+// component depends on an unknown component or if there is a dependency cycle.
+func validateComponents(components []component) error {
+	dependsOn := make(map[string][]string, len(components))
+	for _, c := range components {
+		if _, ok := dependsOn[c.id]; ok {
+			return fmt.Errorf("duplicate component id: %s", c.id)
+		}
+		dependsOn[c.id] = c.dependsOn
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int, len(components))
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("dependency cycle detected at component %s", id)
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		for _, dep := range dependsOn[id] {
+			if _, ok := dependsOn[dep]; !ok {
+				return fmt.Errorf("component %s depends on unknown component %s", id, dep)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		return nil
+	}
+
+	for _, c := range components {
+		if err := visit(c.id); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // getChecks returns a list of components to be checked
 func (hc *HealthChecker) getChecks() []component {
-	var veidemannRunStatus *controllerApi.RunStatus
-	var veidemannIsActive bool
-	var veidemannJobs []string
-
 	return []component{
 		{
 			id: VeidemannDashboard,
 			checkers: []checker{
-				func(ctx context.Context) *Result {
+				single(func(ctx context.Context, _ Results) *Result {
 					statusCode, status, err := hc.httpClient.CheckVeidemannDashboard(ctx)
 					result := &Result{
 						Description: "check veidemann dashboard is responding",
@@ -131,21 +393,25 @@ func (hc *HealthChecker) getChecks() []component {
 						}(err),
 					}
 					return result
-				},
+				}),
 			},
 		},
 		{
 			id: VeidemannCrawlerStatus,
 			checkers: []checker{
-				func(ctx context.Context) *Result {
-					var err error
-					veidemannRunStatus, err = hc.controllerClient.GetRunStatus(ctx)
+				single(func(ctx context.Context, _ Results) *Result {
+					runStatus, err := hc.controllerClient.GetRunStatus(ctx)
 					result := &Result{
 						Description: "check crawler status",
 						Type:        "harvester",
 						Time:        time.Now(),
 						Err:         err,
-						Value:       fmt.Sprintf("%v", veidemannRunStatus),
+						Value: func() Value {
+							if runStatus == nil {
+								return nil
+							}
+							return *runStatus
+						}(),
 						Status: func(err error) Status {
 							if err != nil {
 								return StatusWarning
@@ -156,49 +422,51 @@ func (hc *HealthChecker) getChecks() []component {
 					}
 
 					return result
-				},
+				}),
 			},
 		},
 		{
-			id: VeidemannJobs,
+			id: VeidemannController,
 			checkers: []checker{
-				func(ctx context.Context) *Result {
-					result := &Result{
-						Description: "check which jobs are running",
-						Type:        "harvester",
-						Time:        time.Now(),
+				single(func(ctx context.Context, _ Results) *Result {
+					state := hc.controllerClient.State()
+					// an idle connection has not been used yet, so it is
+					// used once to get the state of the actual connection
+					if state == connectivity.Idle {
+						_, _ = hc.controllerClient.GetRunStatus(ctx)
+						state = hc.controllerClient.State()
 					}
-					var err error
-					veidemannJobs, err = hc.controllerClient.GetRunningJobs(ctx)
-					if err != nil {
-						result.Err = err
-						result.Status = func(err error) Status {
-							if err != nil {
+					return &Result{
+						Description: "check state of connection to controller",
+						Type:        "connection",
+						Time:        time.Now(),
+						Value:       state.String(),
+						Status: func() Status {
+							switch state {
+							case connectivity.Ready, connectivity.Idle:
+								return StatusPass
+							case connectivity.Connecting:
 								return StatusWarning
-							} else {
-								return StatusUndefined
+							default:
+								return StatusFail
 							}
-						}(err)
-					} else {
-						if len(veidemannJobs) > 0 {
-							result.Value = veidemannJobs
-						}
+						}(),
 					}
-					return result
-				},
+				}),
 			},
 		},
+		hc.jobsComponent(),
+		hc.jobProgressComponent(),
 		{
 			id: VeidemannActivity,
 			checkers: []checker{
-				func(ctx context.Context) *Result {
+				single(func(ctx context.Context, _ Results) *Result {
 					result := &Result{
 						Description: "check if there is harvesting activity",
 						Type:        "harvester",
 						Time:        time.Now(),
 					}
-					var err error
-					veidemannIsActive, err = hc.prometheusClient.IsActivity(ctx)
+					isActive, err := hc.prometheusClient.IsActivity(ctx)
 					if err != nil {
 						result.Err = err
 						result.Status = func(err error) Status {
@@ -209,18 +477,26 @@ func (hc *HealthChecker) getChecks() []component {
 							}
 						}(err)
 					} else {
-						result.Value = veidemannIsActive
+						result.Value = isActive
 					}
 
 					return result
-				},
+				}),
 			},
 		},
 		{
-			id: VeidemannHarvest,
+			id:        VeidemannHarvest,
+			dependsOn: []string{VeidemannCrawlerStatus, VeidemannJobs, VeidemannActivity, VeidemannSchedule},
 			checkers: []checker{
-				func(ctx context.Context) *Result {
-					return &Result{
+				single(func(ctx context.Context, deps Results) *Result {
+					var veidemannRunStatus *controllerApi.RunStatus
+					if runStatus, ok := deps.value(VeidemannCrawlerStatus).(controllerApi.RunStatus); ok {
+						veidemannRunStatus = &runStatus
+					}
+					veidemannJobs := deps.jobExecutions()
+					veidemannIsActive, _ := deps.value(VeidemannActivity).(bool)
+
+					result := &Result{
 						Description: "check if veidemann harvest is nominal",
 						Type:        "harvester",
 						Time:        time.Now(),
@@ -241,7 +517,15 @@ func (hc *HealthChecker) getChecks() []component {
 							return StatusPass
 						}(),
 					}
-				},
+					// a running crawler should start its jobs as scheduled
+					if veidemannRunStatus != nil && *veidemannRunStatus == controllerApi.RunStatus_RUNNING {
+						if scheduleStatus := deps.scheduleStatus(); scheduleStatus > result.Status {
+							result.Status = scheduleStatus
+							result.Err = errors.New("scheduled jobs have not started")
+						}
+					}
+					return result
+				}),
 			},
 		},
 	}
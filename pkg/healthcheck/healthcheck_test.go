@@ -0,0 +1,240 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	controllerApi "github.com/nlnwa/veidemann-api-go/controller/v1"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/controller"
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestValidateComponents(t *testing.T) {
+	tests := []struct {
+		name       string
+		components []component
+		err        string
+	}{
+		{"no components", nil, ""},
+		{"dependencies", []component{
+			testComponent("c", "c", "a", "b"),
+			testComponent("b", "b", "a"),
+			testComponent("a", "a"),
+		}, ""},
+		{"duplicate id", []component{
+			testComponent("a", "a"),
+			testComponent("b", "b"),
+			testComponent("a", "a"),
+		}, "duplicate component id: a"},
+		{"unknown dependency", []component{
+			testComponent("a", "a", "b"),
+		}, "component a depends on unknown component b"},
+		{"depends on itself", []component{
+			testComponent("a", "a", "a"),
+		}, "dependency cycle"},
+		{"cycle", []component{
+			testComponent("a", "a", "b"),
+			testComponent("b", "b", "c"),
+			testComponent("c", "c", "a"),
+		}, "dependency cycle"},
+		{"cycle after shared dependency", []component{
+			testComponent("shared", "shared"),
+			testComponent("a", "a", "shared", "b"),
+			testComponent("b", "b", "shared", "a"),
+		}, "dependency cycle"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateComponents(test.components)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestRunChecksDependencyOrder(t *testing.T) {
+	// components are listed before the components they depend on
+	hc := &HealthChecker{components: []component{
+		testComponent("d", "d", "c", "a"),
+		testComponent("c", "c", "b"),
+		testComponent("b", "b", "a"),
+		testComponent("a", "a"),
+	}}
+	if err := validateComponents(hc.components); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	values := make(map[string]Value)
+	hc.RunChecks(func(checkResult *CheckResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, checkResult.Name)
+		values[checkResult.Name] = checkResult.Results[0].Value
+	})
+
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("expected components to be observed in order %v, got %v", want, order)
+	}
+	want := map[string]Value{
+		"a": "a",
+		"b": "b(a)",
+		"c": "c(b(a))",
+		"d": "d(c(b(a)),a)",
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+}
+
+// connectionController is a fake controller with a connection that is idle until it is used.
+type connectionController struct {
+	controller.Query
+	mu        sync.Mutex
+	state     connectivity.State
+	usedState connectivity.State
+	runStatus controllerApi.RunStatus
+	err       error
+	calls     int
+}
+
+func (c *connectionController) GetRunStatus(context.Context) (*controllerApi.RunStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	c.state = c.usedState
+	if c.err != nil {
+		return nil, c.err
+	}
+	runStatus := c.runStatus
+	return &runStatus, nil
+}
+
+func (c *connectionController) State() connectivity.State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// componentById returns the component of hc with the given id.
+func componentById(t *testing.T, hc *HealthChecker, id string) component {
+	t.Helper()
+	for _, c := range hc.getChecks() {
+		if c.id == id {
+			return c
+		}
+	}
+	t.Fatalf("no component %s", id)
+	return component{}
+}
+
+func TestControllerConnectionComponent(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     connectivity.State
+		usedState connectivity.State
+		status    Status
+		calls     int
+	}{
+		{"ready", connectivity.Ready, connectivity.Ready, StatusPass, 0},
+		// an idle connection is used to get the actual state
+		{"idle", connectivity.Idle, connectivity.Ready, StatusPass, 1},
+		{"idle and unavailable", connectivity.Idle, connectivity.TransientFailure, StatusFail, 1},
+		{"connecting", connectivity.Connecting, connectivity.Connecting, StatusWarning, 0},
+		{"failure", connectivity.TransientFailure, connectivity.TransientFailure, StatusFail, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &connectionController{state: test.state, usedState: test.usedState, err: errors.New("unavailable")}
+			hc := &HealthChecker{controllerClient: fake}
+			c := componentById(t, hc, VeidemannController)
+			if len(c.dependsOn) != 0 {
+				t.Errorf("expected no dependencies, got %v", c.dependsOn)
+			}
+			result := c.checkers[0](context.Background(), nil)[0]
+			if result.Status != test.status || result.Value != test.usedState.String() {
+				t.Errorf("expected %v with state %s, got %v with state %v", test.status, test.usedState, result.Status, result.Value)
+			}
+			if fake.calls != test.calls {
+				t.Errorf("expected %d calls, got %d", test.calls, fake.calls)
+			}
+		})
+	}
+}
+
+func TestCrawlerStatusComponent(t *testing.T) {
+	fake := &connectionController{state: connectivity.Ready, usedState: connectivity.Ready, runStatus: controllerApi.RunStatus_PAUSED}
+	hc := &HealthChecker{controllerClient: fake}
+	c := componentById(t, hc, VeidemannCrawlerStatus)
+
+	result := c.checkers[0](context.Background(), nil)[0]
+	if result.Value != controllerApi.RunStatus_PAUSED || result.Status != StatusUndefined {
+		t.Errorf("expected the run status, got %v (%v)", result.Value, result.Status)
+	}
+	deps := Results{VeidemannCrawlerStatus: {Name: VeidemannCrawlerStatus, Results: []*Result{result}}}
+	if !deps.crawlerPaused() {
+		t.Error("expected the crawler to be paused")
+	}
+	// the run status is reported by name
+	if checks := ToChecks(deps[VeidemannCrawlerStatus]); checks[0].ObservedValue != "PAUSED" {
+		t.Errorf("expected observed value PAUSED, got %v", checks[0].ObservedValue)
+	}
+
+	fake.err = errors.New("unavailable")
+	result = c.checkers[0](context.Background(), nil)[0]
+	if result.Value != nil || result.Status != StatusWarning {
+		t.Errorf("expected a warning without value, got %v (%v)", result.Value, result.Status)
+	}
+	deps = Results{VeidemannCrawlerStatus: {Name: VeidemannCrawlerStatus, Results: []*Result{result}}}
+	if deps.crawlerPaused() {
+		t.Error("expected the crawler not to be paused when the status is unknown")
+	}
+}
+
+func TestHarvestComponent(t *testing.T) {
+	hc := &HealthChecker{}
+	c := componentById(t, hc, VeidemannHarvest)
+	runningJob := &CheckResult{Results: []*Result{{Id: "jes-1", Value: JobExecution{JobExecutionId: "jes-1"}}}}
+
+	tests := []struct {
+		name      string
+		runStatus Value
+		jobs      *CheckResult
+		active    bool
+		status    Status
+	}{
+		{"unknown run status", nil, nil, false, StatusFail},
+		{"running without jobs", controllerApi.RunStatus_RUNNING, nil, false, StatusPass},
+		{"running and active", controllerApi.RunStatus_RUNNING, runningJob, true, StatusPass},
+		{"running but inactive", controllerApi.RunStatus_RUNNING, runningJob, false, StatusFail},
+		{"paused", controllerApi.RunStatus_PAUSED, runningJob, false, StatusPass},
+		{"paused but active", controllerApi.RunStatus_PAUSED, runningJob, true, StatusWarning},
+		{"pause requested", controllerApi.RunStatus_PAUSE_REQUESTED, runningJob, true, StatusPass},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deps := Results{
+				VeidemannCrawlerStatus: {Results: []*Result{{Value: test.runStatus}}},
+				VeidemannActivity:      {Results: []*Result{{Value: test.active}}},
+			}
+			if test.jobs != nil {
+				deps[VeidemannJobs] = test.jobs
+			}
+			if result := c.checkers[0](context.Background(), deps)[0]; result.Status != test.status {
+				t.Errorf("expected %v, got %v", test.status, result.Status)
+			}
+		})
+	}
+}
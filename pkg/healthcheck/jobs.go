@@ -0,0 +1,137 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/nlnwa/veidemann-api-go/config/v1"
+	"github.com/nlnwa/veidemann-api-go/frontier/v1"
+)
+
+// JobExecution describes a running job execution. It has the start time
+// rather than the elapsed time, so the value only changes with the job execution.
+type JobExecution struct {
+	JobExecutionId string `json:"jobExecutionId"`
+	JobId          string `json:"jobId"`
+	JobName        string `json:"jobName,omitempty"`
+	State          string `json:"state"`
+	StartTime      string `json:"startTime,omitempty"`
+
+	// status is the job execution status reported by the controller.
+	status *frontier.JobExecutionStatus
+}
+
+// jobExecutions returns the running job executions reported by the jobs component.
+func (r Results) jobExecutions() []JobExecution {
+	var jobExecutions []JobExecution
+	if checkResult := r[VeidemannJobs]; checkResult != nil {
+		for _, result := range checkResult.Results {
+			if jobExecution, ok := result.Value.(JobExecution); ok {
+				jobExecutions = append(jobExecutions, jobExecution)
+			}
+		}
+	}
+	return jobExecutions
+}
+
+// jobExecutionsErr returns the error of the jobs component if the running job
+// executions could not be listed.
+func (r Results) jobExecutionsErr() error {
+	if checkResult := r[VeidemannJobs]; checkResult != nil {
+		for _, result := range checkResult.Results {
+			if _, ok := result.Value.(JobExecution); !ok && result.Err != nil {
+				return result.Err
+			}
+		}
+	}
+	return nil
+}
+
+// jobExecutionLink returns the URL of a job execution in the Veidemann dashboard.
+func (hc *HealthChecker) jobExecutionLink(id string) string {
+	return strings.TrimSuffix(hc.dashboardUrl, "/") + "/report/jobexecution/" + id
+}
+
+// jobsComponent returns a component that reports every running job execution.
+func (hc *HealthChecker) jobsComponent() component {
+	return component{
+		id: VeidemannJobs,
+		checkers: []checker{
+			func(ctx context.Context, _ Results) []*Result {
+				jeses, err := hc.controllerClient.ListRunningJobExecutions(ctx)
+				if err != nil {
+					return []*Result{{
+						Description: "check which jobs are running",
+						Type:        "harvester",
+						Time:        hc.now(),
+						Err:         err,
+						Status:      StatusWarning,
+					}}
+				}
+				if len(jeses) == 0 {
+					return []*Result{{
+						Description: "check which jobs are running",
+						Type:        "harvester",
+						Time:        hc.now(),
+					}}
+				}
+
+				// job names are looked up per job, so a failed lookup only
+				// downgrades the executions of that job
+				jobNames := make(map[string]string)
+				lookupErrs := make(map[string]error)
+				lookedUp := make(map[string]bool)
+				for _, jes := range jeses {
+					jobId := jes.GetJobId()
+					if lookedUp[jobId] {
+						continue
+					}
+					lookedUp[jobId] = true
+					crawlJobs, err := hc.controllerClient.ListConfigObjects(ctx, config.Kind_crawlJob, jobId)
+					if err != nil {
+						lookupErrs[jobId] = fmt.Errorf("failed to look up job name: %w", err)
+						continue
+					}
+					for _, crawlJob := range crawlJobs {
+						jobNames[crawlJob.GetId()] = crawlJob.GetMeta().GetName()
+					}
+				}
+
+				now := hc.now()
+				var results []*Result
+				for _, jes := range jeses {
+					jobExecution := JobExecution{
+						JobExecutionId: jes.GetId(),
+						JobId:          jes.GetJobId(),
+						JobName:        jobNames[jes.GetJobId()],
+						State:          jes.GetState().String(),
+						status:         jes,
+					}
+					if startTime, err := ptypes.Timestamp(jes.GetStartTime()); err == nil {
+						jobExecution.StartTime = startTime.Format(time.RFC3339)
+					}
+					result := &Result{
+						Id:          jes.GetId(),
+						Description: "running job execution",
+						Type:        "harvester",
+						Time:        now,
+						Value:       jobExecution,
+						Links:       []string{hc.jobExecutionLink(jes.GetId())},
+					}
+					if jobExecution.JobName != "" {
+						result.Description = "running job execution of " + jobExecution.JobName
+					}
+					if err, ok := lookupErrs[jes.GetJobId()]; ok {
+						result.Err = err
+						result.Status = StatusWarning
+					}
+					results = append(results, result)
+				}
+				return results
+			},
+		},
+	}
+}
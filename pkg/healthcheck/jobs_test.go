@@ -0,0 +1,141 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/nlnwa/veidemann-api-go/config/v1"
+	"github.com/nlnwa/veidemann-api-go/frontier/v1"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/controller"
+)
+
+// jobsController is a fake controller with running job executions and crawl jobs.
+type jobsController struct {
+	controller.Query
+	jobExecutions   []*frontier.JobExecutionStatus
+	jobExecutionErr error
+	// jobNames are the names of the crawl jobs by id
+	jobNames map[string]string
+	// lookupErrs are the errors of looking up crawl jobs by id
+	lookupErrs map[string]error
+}
+
+func (c *jobsController) ListRunningJobExecutions(context.Context) ([]*frontier.JobExecutionStatus, error) {
+	return c.jobExecutions, c.jobExecutionErr
+}
+
+func (c *jobsController) ListConfigObjects(_ context.Context, _ config.Kind, ids ...string) ([]*config.ConfigObject, error) {
+	var crawlJobs []*config.ConfigObject
+	for _, id := range ids {
+		if err := c.lookupErrs[id]; err != nil {
+			return nil, err
+		}
+		if name, ok := c.jobNames[id]; ok {
+			crawlJobs = append(crawlJobs, &config.ConfigObject{Id: id, Meta: &config.Meta{Name: name}})
+		}
+	}
+	return crawlJobs, nil
+}
+
+func runningJobExecution(t *testing.T, id string, jobId string, start time.Time) *frontier.JobExecutionStatus {
+	startTime, err := ptypes.TimestampProto(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &frontier.JobExecutionStatus{Id: id, JobId: jobId, State: frontier.JobExecutionStatus_RUNNING, StartTime: startTime}
+}
+
+func TestJobsComponent(t *testing.T) {
+	start := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	fake := &jobsController{
+		jobExecutions: []*frontier.JobExecutionStatus{
+			runningJobExecution(t, "jes-1", "job-1", start),
+			runningJobExecution(t, "jes-2", "job-2", start.Add(time.Hour)),
+			runningJobExecution(t, "jes-3", "job-1", start.Add(2*time.Hour)),
+		},
+		jobNames:   map[string]string{"job-1": "daily"},
+		lookupErrs: map[string]error{"job-2": errors.New("unavailable")},
+	}
+	now := start.Add(3 * time.Hour)
+	hc := &HealthChecker{
+		controllerClient: fake,
+		dashboardUrl:     "https://veidemann.example.org/veidemann/",
+		now:              func() time.Time { return now },
+	}
+	c := hc.jobsComponent()
+
+	results := c.checkers[0](context.Background(), nil)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	tests := []struct {
+		id          string
+		description string
+		status      Status
+		err         bool
+		value       JobExecution
+	}{
+		{"jes-1", "running job execution of daily", StatusUndefined, false,
+			JobExecution{JobExecutionId: "jes-1", JobId: "job-1", JobName: "daily", State: "RUNNING", StartTime: "2021-03-01T08:00:00Z"}},
+		// only the executions of the job whose name could not be looked up are downgraded
+		{"jes-2", "running job execution", StatusWarning, true,
+			JobExecution{JobExecutionId: "jes-2", JobId: "job-2", State: "RUNNING", StartTime: "2021-03-01T09:00:00Z"}},
+		{"jes-3", "running job execution of daily", StatusUndefined, false,
+			JobExecution{JobExecutionId: "jes-3", JobId: "job-1", JobName: "daily", State: "RUNNING", StartTime: "2021-03-01T10:00:00Z"}},
+	}
+	for i, test := range tests {
+		result := results[i]
+		if result.Id != test.id || result.Description != test.description || result.Status != test.status || (result.Err != nil) != test.err {
+			t.Errorf("%s: unexpected result: %+v", test.id, result)
+		}
+		value, ok := result.Value.(JobExecution)
+		if !ok {
+			t.Fatalf("%s: expected a job execution, got %T", test.id, result.Value)
+		}
+		value.status = nil
+		if !reflect.DeepEqual(value, test.value) {
+			t.Errorf("%s: expected %+v, got %+v", test.id, test.value, value)
+		}
+		if want := "https://veidemann.example.org/veidemann/report/jobexecution/" + test.id; len(result.Links) != 1 || result.Links[0] != want {
+			t.Errorf("%s: expected link %s, got %v", test.id, want, result.Links)
+		}
+	}
+
+	// the observed value of a running job execution does not change between checks
+	before, _ := json.Marshal(results[0].Value)
+	now = now.Add(time.Minute)
+	after, _ := json.Marshal(c.checkers[0](context.Background(), nil)[0].Value)
+	if string(before) != string(after) {
+		t.Errorf("expected the same value, got %s and %s", before, after)
+	}
+}
+
+func TestJobsComponentErrors(t *testing.T) {
+	fake := &jobsController{jobExecutionErr: errors.New("unavailable")}
+	hc := &HealthChecker{controllerClient: fake, now: time.Now}
+	c := hc.jobsComponent()
+
+	results := c.checkers[0](context.Background(), nil)
+	if len(results) != 1 || results[0].Status != StatusWarning || results[0].Err == nil || results[0].Value != nil {
+		t.Errorf("expected a warning without value, got %+v", results[0])
+	}
+	if err := (Results{VeidemannJobs: {Results: results}}).jobExecutionsErr(); err == nil {
+		t.Error("expected the error of the jobs component")
+	}
+
+	// no running job executions
+	fake.jobExecutionErr = nil
+	results = c.checkers[0](context.Background(), nil)
+	if len(results) != 1 || results[0].Status != StatusUndefined || results[0].Err != nil {
+		t.Errorf("expected a result without job executions, got %+v", results[0])
+	}
+	deps := Results{VeidemannJobs: {Results: results}}
+	if len(deps.jobExecutions()) != 0 || deps.jobExecutionsErr() != nil {
+		t.Error("expected no job executions and no error")
+	}
+}
@@ -0,0 +1,148 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nlnwa/veidemann-api-go/frontier/v1"
+)
+
+var errStalled = errors.New("no progress since previous check")
+
+// JobProgress is the crawl progress of a job execution.
+type JobProgress struct {
+	JobExecutionId      string           `json:"jobExecutionId"`
+	JobId               string           `json:"jobId"`
+	DocumentsCrawled    int64            `json:"documentsCrawled"`
+	DocumentsFailed     int64            `json:"documentsFailed"`
+	DocumentsOutOfScope int64            `json:"documentsOutOfScope"`
+	DocumentsDenied     int64            `json:"documentsDenied"`
+	DocumentsRetried    int64            `json:"documentsRetried"`
+	BytesCrawled        int64            `json:"bytesCrawled"`
+	UrisCrawled         int64            `json:"urisCrawled"`
+	ExecutionsState     map[string]int32 `json:"executionsState,omitempty"`
+}
+
+func newJobProgress(jes *frontier.JobExecutionStatus) JobProgress {
+	return JobProgress{
+		JobExecutionId:      jes.GetId(),
+		JobId:               jes.GetJobId(),
+		DocumentsCrawled:    jes.GetDocumentsCrawled(),
+		DocumentsFailed:     jes.GetDocumentsFailed(),
+		DocumentsOutOfScope: jes.GetDocumentsOutOfScope(),
+		DocumentsDenied:     jes.GetDocumentsDenied(),
+		DocumentsRetried:    jes.GetDocumentsRetried(),
+		BytesCrawled:        jes.GetBytesCrawled(),
+		UrisCrawled:         jes.GetUrisCrawled(),
+		ExecutionsState:     jes.GetExecutionsState(),
+	}
+}
+
+// counters returns the counters that increase when a job execution makes progress.
+func (p JobProgress) counters() [7]int64 {
+	return [7]int64{
+		p.DocumentsCrawled,
+		p.DocumentsFailed,
+		p.DocumentsOutOfScope,
+		p.DocumentsDenied,
+		p.DocumentsRetried,
+		p.BytesCrawled,
+		p.UrisCrawled,
+	}
+}
+
+// progressTracker remembers the progress of running job executions between polls.
+type progressTracker struct {
+	mu       sync.Mutex
+	time     time.Time
+	previous map[string]JobProgress
+	stalled  map[string]bool
+}
+
+// update stores the progress of the running job executions polled at the given time and
+// returns the ids of the job executions that have made no progress since the
+// previous poll. Progress that is not newer than the previous poll is ignored.
+func (t *progressTracker) update(polled time.Time, progress []JobProgress) map[string]bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.previous != nil && !polled.After(t.time) {
+		return t.stalled
+	}
+
+	stalled := make(map[string]bool)
+	current := make(map[string]JobProgress, len(progress))
+	for _, p := range progress {
+		if previous, ok := t.previous[p.JobExecutionId]; ok && previous.counters() == p.counters() {
+			stalled[p.JobExecutionId] = true
+		}
+		current[p.JobExecutionId] = p
+	}
+	t.time = polled
+	t.previous = current
+	t.stalled = stalled
+
+	return stalled
+}
+
+// jobProgressComponent returns a component that reports the progress of every
+// running job execution and warns when a job execution has stalled. Job
+// executions are not expected to make progress while the crawler is paused.
+func (hc *HealthChecker) jobProgressComponent() component {
+	tracker := &progressTracker{}
+
+	return component{
+		id:        VeidemannJobProgress,
+		dependsOn: []string{VeidemannCrawlerStatus, VeidemannJobs},
+		checkers: []checker{
+			func(ctx context.Context, deps Results) []*Result {
+				if err := deps.jobExecutionsErr(); err != nil {
+					return []*Result{{
+						Description: "check progress of running jobs",
+						Type:        "harvester",
+						Time:        time.Now(),
+						Err:         err,
+						Status:      StatusWarning,
+					}}
+				}
+				jobExecutions := deps.jobExecutions()
+				if len(jobExecutions) == 0 {
+					return []*Result{{
+						Description: "no running jobs",
+						Type:        "harvester",
+						Time:        time.Now(),
+						Status:      StatusPass,
+					}}
+				}
+
+				var progress []JobProgress
+				for _, jobExecution := range jobExecutions {
+					progress = append(progress, newJobProgress(jobExecution.status))
+				}
+				stalled := tracker.update(deps[VeidemannJobs].Time, progress)
+
+				paused := deps.crawlerPaused()
+
+				var results []*Result
+				for _, p := range progress {
+					result := &Result{
+						Id:          p.JobExecutionId,
+						Description: "check progress of job execution",
+						Type:        "harvester",
+						Time:        time.Now(),
+						Value:       p,
+						Status:      StatusPass,
+					}
+					if stalled[p.JobExecutionId] && !paused {
+						result.Status = StatusWarning
+						result.Err = errStalled
+					}
+					results = append(results, result)
+				}
+				return results
+			},
+		},
+	}
+}
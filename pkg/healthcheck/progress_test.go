@@ -0,0 +1,86 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	controllerApi "github.com/nlnwa/veidemann-api-go/controller/v1"
+	"github.com/nlnwa/veidemann-api-go/frontier/v1"
+)
+
+// progressDeps returns the dependencies of the job progress component with a
+// running job execution that has crawled the given number of documents.
+func progressDeps(polled time.Time, runStatus controllerApi.RunStatus, documentsCrawled int64) Results {
+	jes := &frontier.JobExecutionStatus{Id: "jes-1", JobId: "job-1", DocumentsCrawled: documentsCrawled}
+	return Results{
+		VeidemannCrawlerStatus: {
+			Name:    VeidemannCrawlerStatus,
+			Results: []*Result{{Value: runStatus}},
+			Time:    polled,
+		},
+		VeidemannJobs: {
+			Name: VeidemannJobs,
+			Results: []*Result{{
+				Id:    jes.GetId(),
+				Value: JobExecution{JobExecutionId: jes.GetId(), JobId: jes.GetJobId(), status: jes},
+			}},
+			Time: polled,
+		},
+	}
+}
+
+func TestJobProgressComponent(t *testing.T) {
+	// the component must not query the controller itself
+	hc := &HealthChecker{}
+	c := hc.jobProgressComponent()
+	check := func(deps Results) *Result {
+		t.Helper()
+		results := c.checkers[0](context.Background(), deps)
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result, got %d", len(results))
+		}
+		return results[0]
+	}
+
+	start := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		polled           time.Time
+		runStatus        controllerApi.RunStatus
+		documentsCrawled int64
+		status           Status
+	}{
+		{"first poll", start, controllerApi.RunStatus_RUNNING, 10, StatusPass},
+		{"progress", start.Add(time.Minute), controllerApi.RunStatus_RUNNING, 20, StatusPass},
+		{"same poll", start.Add(time.Minute), controllerApi.RunStatus_RUNNING, 20, StatusPass},
+		{"stalled", start.Add(2 * time.Minute), controllerApi.RunStatus_RUNNING, 20, StatusWarning},
+		{"same poll of stalled", start.Add(2 * time.Minute), controllerApi.RunStatus_RUNNING, 20, StatusWarning},
+		{"paused", start.Add(3 * time.Minute), controllerApi.RunStatus_PAUSED, 20, StatusPass},
+		{"pause requested", start.Add(4 * time.Minute), controllerApi.RunStatus_PAUSE_REQUESTED, 20, StatusPass},
+		{"resumed", start.Add(5 * time.Minute), controllerApi.RunStatus_RUNNING, 30, StatusPass},
+	}
+	for _, test := range tests {
+		result := check(progressDeps(test.polled, test.runStatus, test.documentsCrawled))
+		if result.Status != test.status {
+			t.Errorf("%s: expected status %v, got %v (%v)", test.name, test.status, result.Status, result.Err)
+		}
+		if test.status == StatusWarning && !errors.Is(result.Err, errStalled) {
+			t.Errorf("%s: expected stalled error, got %v", test.name, result.Err)
+		}
+		if p, ok := result.Value.(JobProgress); !ok || p.JobExecutionId != "jes-1" || p.DocumentsCrawled != test.documentsCrawled {
+			t.Errorf("%s: unexpected progress: %+v", test.name, result.Value)
+		}
+	}
+
+	if result := check(Results{}); result.Status != StatusPass || result.Value != nil {
+		t.Errorf("expected no running jobs, got %+v", result)
+	}
+
+	err := errors.New("unavailable")
+	result := check(Results{VeidemannJobs: {Results: []*Result{{Err: err, Status: StatusWarning}}}})
+	if result.Status != StatusWarning || !errors.Is(result.Err, err) {
+		t.Errorf("expected error of jobs component, got %+v", result)
+	}
+}
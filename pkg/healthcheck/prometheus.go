@@ -0,0 +1,120 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrometheusCheck is a check of the value of a PromQL expression.
+type PrometheusCheck struct {
+	// Id is the id of the component reported by the check.
+	Id string `mapstructure:"id"`
+	// Type is the component type, "metric" if empty.
+	Type string `mapstructure:"type"`
+	// Query is the PromQL expression. It must evaluate to a scalar or a single sample.
+	Query string `mapstructure:"query"`
+	// Warn is a threshold in the form "<operator> <value>", e.g. "> 100".
+	// The check warns if the value compared to the threshold value is true.
+	Warn string `mapstructure:"warn"`
+	// Fail is a threshold like Warn. The check fails if the comparison is true.
+	Fail        string `mapstructure:"fail"`
+	Unit        string `mapstructure:"unit"`
+	Description string `mapstructure:"description"`
+}
+
+type threshold struct {
+	operator string
+	value    float64
+}
+
+var comparisons = map[string]func(a, b float64) bool{
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// parseThreshold parses a threshold in the form "<operator> <value>".
+// An empty string parses to nil.
+func parseThreshold(s string) (*threshold, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	// try two character operators first
+	for _, n := range []int{2, 1} {
+		if len(s) < n {
+			continue
+		}
+		operator := s[:n]
+		if _, ok := comparisons[operator]; !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(s[n:]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid threshold value in %q: %w", s, err)
+		}
+		return &threshold{operator: operator, value: value}, nil
+	}
+	return nil, fmt.Errorf("invalid threshold operator in %q", s)
+}
+
+func (t *threshold) exceeded(value float64) bool {
+	return t != nil && comparisons[t.operator](value, t.value)
+}
+
+// prometheusComponent returns a component that checks the value of a PromQL expression.
+func (hc *HealthChecker) prometheusComponent(check PrometheusCheck) (component, error) {
+	if check.Id == "" {
+		return component{}, fmt.Errorf("prometheus check is missing id")
+	}
+	if check.Query == "" {
+		return component{}, fmt.Errorf("prometheus check %s is missing query", check.Id)
+	}
+	warn, err := parseThreshold(check.Warn)
+	if err != nil {
+		return component{}, fmt.Errorf("prometheus check %s: %w", check.Id, err)
+	}
+	fail, err := parseThreshold(check.Fail)
+	if err != nil {
+		return component{}, fmt.Errorf("prometheus check %s: %w", check.Id, err)
+	}
+	componentType := check.Type
+	if componentType == "" {
+		componentType = "metric"
+	}
+
+	return component{
+		id: check.Id,
+		checkers: []checker{
+			single(func(ctx context.Context, _ Results) *Result {
+				result := &Result{
+					Description: check.Description,
+					Type:        componentType,
+					Unit:        check.Unit,
+					Time:        time.Now(),
+				}
+				value, err := hc.prometheusClient.QueryValue(ctx, check.Query)
+				if err != nil {
+					result.Err = err
+					result.Status = StatusWarning
+					return result
+				}
+				result.Value = value
+				if fail.exceeded(value) {
+					result.Status = StatusFail
+				} else if warn.exceeded(value) {
+					result.Status = StatusWarning
+				} else {
+					result.Status = StatusPass
+				}
+				return result
+			}),
+		},
+	}, nil
+}
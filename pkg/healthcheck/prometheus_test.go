@@ -0,0 +1,124 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/prometheus"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		s         string
+		threshold *threshold
+		ok        bool
+	}{
+		{"", nil, true},
+		{"  ", nil, true},
+		{"> 100", &threshold{">", 100}, true},
+		{">=100", &threshold{">=", 100}, true},
+		{" <= -1.5 ", &threshold{"<=", -1.5}, true},
+		{"< 1e3", &threshold{"<", 1000}, true},
+		{"== 0", &threshold{"==", 0}, true},
+		{"!= 0", &threshold{"!=", 0}, true},
+		{"100", nil, false},
+		{"=> 100", nil, false},
+		{"= 100", nil, false},
+		{">", nil, false},
+		{"> many", nil, false},
+	}
+	for _, test := range tests {
+		threshold, err := parseThreshold(test.s)
+		if test.ok != (err == nil) {
+			t.Errorf("%q: expected ok %v, got error %v", test.s, test.ok, err)
+			continue
+		}
+		if (threshold == nil) != (test.threshold == nil) || threshold != nil && *threshold != *test.threshold {
+			t.Errorf("%q: expected %+v, got %+v", test.s, test.threshold, threshold)
+		}
+	}
+}
+
+func TestThresholdExceeded(t *testing.T) {
+	var none *threshold
+	if none.exceeded(1) {
+		t.Error("expected no threshold never to be exceeded")
+	}
+	tests := []struct {
+		threshold threshold
+		value     float64
+		exceeded  bool
+	}{
+		{threshold{">", 100}, 100, false},
+		{threshold{">", 100}, 101, true},
+		{threshold{">=", 100}, 100, true},
+		{threshold{"<", 1}, 0.5, true},
+		{threshold{"<=", 1}, 2, false},
+		{threshold{"==", 0}, 0, true},
+		{threshold{"!=", 0}, 0, false},
+	}
+	for _, test := range tests {
+		if got := test.threshold.exceeded(test.value); got != test.exceeded {
+			t.Errorf("%s %v with value %v: expected %v, got %v", test.threshold.operator, test.threshold.value, test.value, test.exceeded, got)
+		}
+	}
+}
+
+func TestPrometheusComponent(t *testing.T) {
+	var result string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1614585600,"` + result + `"]}}`))
+	}))
+	defer server.Close()
+
+	hc := &HealthChecker{prometheusClient: prometheus.New(prometheus.Options{Address: server.URL})}
+	c, err := hc.prometheusComponent(PrometheusCheck{Id: "veidemann:queue", Query: "x", Warn: "> 1000", Fail: ">= 10000", Unit: "uris"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		result string
+		status Status
+		value  Value
+	}{
+		{"10", StatusPass, 10.0},
+		{"1001", StatusWarning, 1001.0},
+		{"10000", StatusFail, 10000.0},
+		// the error rate of no requests is 0/0
+		{"NaN", StatusWarning, nil},
+		{"+Inf", StatusWarning, nil},
+	}
+	for _, test := range tests {
+		result = test.result
+		r := c.checkers[0](context.Background(), nil)[0]
+		if r.Status != test.status || r.Value != test.value {
+			t.Errorf("%s: expected %v with value %v, got %v with value %v (%v)", test.result, test.status, test.value, r.Status, r.Value, r.Err)
+		}
+		if test.value == nil && r.Err == nil {
+			t.Errorf("%s: expected error", test.result)
+		}
+		// the result must be encodable in the health document
+		if _, err := json.Marshal(ToChecks(&CheckResult{Name: c.id, Results: []*Result{r}})); err != nil {
+			t.Errorf("%s: %v", test.result, err)
+		}
+	}
+}
+
+func TestPrometheusComponentErrors(t *testing.T) {
+	hc := &HealthChecker{}
+	for _, check := range []PrometheusCheck{
+		{Query: "x"},
+		{Id: "veidemann:queue"},
+		{Id: "veidemann:queue", Query: "x", Warn: "100"},
+		{Id: "veidemann:queue", Query: "x", Fail: "> x"},
+	} {
+		if _, err := hc.prometheusComponent(check); err == nil {
+			t.Errorf("expected error for %+v", check)
+		}
+	}
+}
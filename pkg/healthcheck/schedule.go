@@ -0,0 +1,262 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/nlnwa/veidemann-api-go/config/v1"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	errOverdue = errors.New("job execution is overdue")
+	errMissed  = errors.New("job execution was missed")
+)
+
+// ScheduleOptions configures the check of crawl job schedules.
+type ScheduleOptions struct {
+	// Window is how far back scheduled start times are checked.
+	Window time.Duration
+	// WarnAfter is how long after the scheduled start time a job execution
+	// that has not started is reported as overdue.
+	WarnAfter time.Duration
+	// FailAfter is how long after the scheduled start time a job execution
+	// that has not started is reported as missed.
+	FailAfter time.Duration
+}
+
+// job executions that start this much before the scheduled start time still count
+const scheduleTolerance = time.Minute
+
+// cron expressions of crawl schedules have five fields like crontab
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ScheduledJob describes the latest scheduled start of a crawl job.
+type ScheduledJob struct {
+	JobId          string `json:"jobId"`
+	JobName        string `json:"jobName,omitempty"`
+	CronExpression string `json:"cronExpression"`
+	ScheduledTime  string `json:"scheduledTime"`
+	StartTime      string `json:"startTime,omitempty"`
+}
+
+// previousActivation returns the latest time after from and not after now that
+// schedule activates, and false if there is none.
+func previousActivation(schedule cron.Schedule, from time.Time, now time.Time) (time.Time, bool) {
+	// search backwards in increasing steps to avoid walking through every
+	// activation of frequent schedules
+	for lookback := time.Hour; ; lookback *= 2 {
+		start := now.Add(-lookback)
+		if start.Before(from) {
+			start = from
+		}
+		activation := schedule.Next(start)
+		if !activation.IsZero() && !activation.After(now) {
+			for {
+				next := schedule.Next(activation)
+				if next.IsZero() || next.After(now) {
+					return activation, true
+				}
+				activation = next
+			}
+		}
+		if !start.After(from) {
+			return time.Time{}, false
+		}
+	}
+}
+
+// scheduleStatus returns the worst status of the missed or overdue jobs
+// reported by the schedule component.
+func (r Results) scheduleStatus() Status {
+	status := Status(StatusUndefined)
+	if checkResult := r[VeidemannSchedule]; checkResult != nil {
+		for _, result := range checkResult.Results {
+			if !errors.Is(result.Err, errMissed) && !errors.Is(result.Err, errOverdue) {
+				continue
+			}
+			if result.Status > status {
+				status = result.Status
+			}
+		}
+	}
+	return status
+}
+
+// expectedJob is a crawl job that was scheduled to start at activation.
+type expectedJob struct {
+	crawlJob       *config.ConfigObject
+	cronExpression string
+	activation     time.Time
+}
+
+// scheduleComponent returns a component that reads the crawl jobs and their
+// schedules from the controller and reports every crawl job that was scheduled
+// to start within the schedule window. A job that has not started warns when
+// it is overdue and fails when it is missed, unless the crawler is paused.
+func (hc *HealthChecker) scheduleComponent(options ScheduleOptions) (component, error) {
+	if options.Window <= 0 {
+		return component{}, fmt.Errorf("schedule window must be positive")
+	}
+	if options.FailAfter < options.WarnAfter {
+		return component{}, fmt.Errorf("schedule fail after must not be shorter than warn after")
+	}
+
+	return component{
+		id:        VeidemannSchedule,
+		dependsOn: []string{VeidemannCrawlerStatus, VeidemannJobs},
+		checkers: []checker{
+			func(ctx context.Context, deps Results) []*Result {
+				now := hc.now()
+				errResult := func(err error) []*Result {
+					return []*Result{{
+						Description: "check if scheduled jobs have started",
+						Type:        "harvester",
+						Time:        now,
+						Err:         err,
+						Status:      StatusWarning,
+					}}
+				}
+
+				crawlJobs, err := hc.controllerClient.ListConfigObjects(ctx, config.Kind_crawlJob)
+				if err != nil {
+					return errResult(err)
+				}
+				scheduleConfigs, err := hc.controllerClient.ListConfigObjects(ctx, config.Kind_crawlScheduleConfig)
+				if err != nil {
+					return errResult(err)
+				}
+				schedules := make(map[string]*config.CrawlScheduleConfig)
+				for _, scheduleConfig := range scheduleConfigs {
+					schedules[scheduleConfig.GetId()] = scheduleConfig.GetCrawlScheduleConfig()
+				}
+
+				from := now.Add(-options.Window)
+				var results []*Result
+				var expected []expectedJob
+				for _, crawlJob := range crawlJobs {
+					scheduleId := crawlJob.GetCrawlJob().GetScheduleRef().GetId()
+					if crawlJob.GetCrawlJob().GetDisabled() || scheduleId == "" {
+						continue
+					}
+					schedule, ok := schedules[scheduleId]
+					if !ok {
+						results = append(results, &Result{
+							Id:          crawlJob.GetId(),
+							Description: "check schedule of " + crawlJob.GetMeta().GetName(),
+							Type:        "harvester",
+							Time:        now,
+							Err:         fmt.Errorf("unknown schedule: %s", scheduleId),
+							Status:      StatusWarning,
+						})
+						continue
+					}
+					cronSchedule, err := cronParser.Parse(schedule.GetCronExpression())
+					if err != nil {
+						results = append(results, &Result{
+							Id:          crawlJob.GetId(),
+							Description: "check schedule of " + crawlJob.GetMeta().GetName(),
+							Type:        "harvester",
+							Time:        now,
+							Err:         fmt.Errorf("invalid cron expression %q: %w", schedule.GetCronExpression(), err),
+							Status:      StatusWarning,
+						})
+						continue
+					}
+					activation, ok := previousActivation(cronSchedule, from, now)
+					if !ok {
+						continue
+					}
+					if validFrom, err := ptypes.Timestamp(schedule.GetValidFrom()); err == nil && activation.Before(validFrom) {
+						continue
+					}
+					if validTo, err := ptypes.Timestamp(schedule.GetValidTo()); err == nil && activation.After(validTo) {
+						continue
+					}
+					expected = append(expected, expectedJob{
+						crawlJob:       crawlJob,
+						cronExpression: schedule.GetCronExpression(),
+						activation:     activation,
+					})
+				}
+				if len(expected) == 0 {
+					if len(results) == 0 {
+						results = append(results, &Result{
+							Description: fmt.Sprintf("no jobs scheduled the last %s", options.Window),
+							Type:        "harvester",
+							Time:        now,
+							Status:      StatusPass,
+						})
+					}
+					return results
+				}
+
+				jeses, err := hc.controllerClient.ListJobExecutionsStartedSince(ctx, from.Add(-scheduleTolerance))
+				if err != nil {
+					return errResult(err)
+				}
+				// latest start time of every job
+				started := make(map[string]time.Time)
+				for _, jes := range jeses {
+					startTime, err := ptypes.Timestamp(jes.GetStartTime())
+					if err != nil {
+						continue
+					}
+					if startTime.After(started[jes.GetJobId()]) {
+						started[jes.GetJobId()] = startTime
+					}
+				}
+				running := make(map[string]bool)
+				for _, jobExecution := range deps.jobExecutions() {
+					running[jobExecution.JobId] = true
+				}
+				// a paused crawler is not expected to start jobs
+				paused := deps.crawlerPaused()
+
+				for _, job := range expected {
+					jobId := job.crawlJob.GetId()
+					scheduledJob := ScheduledJob{
+						JobId:          jobId,
+						JobName:        job.crawlJob.GetMeta().GetName(),
+						CronExpression: job.cronExpression,
+						ScheduledTime:  job.activation.Format(time.RFC3339),
+					}
+					result := &Result{
+						Id:          jobId,
+						Description: "check if scheduled job has started",
+						Type:        "harvester",
+						Time:        now,
+						Status:      StatusPass,
+					}
+					if scheduledJob.JobName != "" {
+						result.Description = "check if " + scheduledJob.JobName + " has started as scheduled"
+					}
+					startTime, ok := started[jobId]
+					if ok {
+						scheduledJob.StartTime = startTime.Format(time.RFC3339)
+					}
+					result.Value = scheduledJob
+					if (ok && !startTime.Before(job.activation.Add(-scheduleTolerance))) || running[jobId] {
+						results = append(results, result)
+						continue
+					}
+					if late := now.Sub(job.activation); late >= options.FailAfter && paused {
+						result.Status = StatusWarning
+						result.Err = fmt.Errorf("%w: scheduled to start %s ago while the crawler is paused", errMissed, late.Round(time.Second))
+					} else if late >= options.FailAfter {
+						result.Status = StatusFail
+						result.Err = fmt.Errorf("%w: scheduled to start %s ago", errMissed, late.Round(time.Second))
+					} else if late >= options.WarnAfter {
+						result.Status = StatusWarning
+						result.Err = fmt.Errorf("%w: scheduled to start %s ago", errOverdue, late.Round(time.Second))
+					}
+					results = append(results, result)
+				}
+				return results
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,291 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/nlnwa/veidemann-api-go/config/v1"
+	controllerApi "github.com/nlnwa/veidemann-api-go/controller/v1"
+	"github.com/nlnwa/veidemann-api-go/frontier/v1"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/controller"
+)
+
+func TestPreviousActivation(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 32, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		cron       string
+		from       time.Time
+		activation time.Time
+		ok         bool
+	}{
+		{"frequent", "*/5 * * * *", now.Add(-time.Hour), time.Date(2021, 3, 1, 10, 30, 0, 0, time.UTC), true},
+		{"at now", "32 10 * * *", now.Add(-24 * time.Hour), now, true},
+		{"daily", "0 8 * * *", now.Add(-24 * time.Hour), time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC), true},
+		{"yesterday", "0 11 * * *", now.Add(-24 * time.Hour), time.Date(2021, 2, 28, 11, 0, 0, 0, time.UTC), true},
+		{"yearly", "0 0 1 1 *", now.AddDate(-1, 0, 0), time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"before window", "0 0 1 1 *", now.Add(-24 * time.Hour), time.Time{}, false},
+		{"window starts at activation", "0 10 * * *", time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC), time.Time{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := cronParser.Parse(test.cron)
+			if err != nil {
+				t.Fatal(err)
+			}
+			activation, ok := previousActivation(schedule, test.from, now)
+			if ok != test.ok || !activation.Equal(test.activation) {
+				t.Errorf("expected %v %v, got %v %v", test.activation, test.ok, activation, ok)
+			}
+		})
+	}
+}
+
+// scheduleController is a fake controller with crawl jobs, schedules and job executions.
+type scheduleController struct {
+	controller.Query
+	crawlJobs       []*config.ConfigObject
+	schedules       []*config.ConfigObject
+	jobExecutions   []*frontier.JobExecutionStatus
+	startedSince    time.Time
+	jobExecutionErr error
+}
+
+func (c *scheduleController) ListConfigObjects(_ context.Context, kind config.Kind, _ ...string) ([]*config.ConfigObject, error) {
+	switch kind {
+	case config.Kind_crawlJob:
+		return c.crawlJobs, nil
+	case config.Kind_crawlScheduleConfig:
+		return c.schedules, nil
+	}
+	return nil, nil
+}
+
+func (c *scheduleController) ListJobExecutionsStartedSince(_ context.Context, since time.Time) ([]*frontier.JobExecutionStatus, error) {
+	c.startedSince = since
+	return c.jobExecutions, c.jobExecutionErr
+}
+
+func crawlJob(id string, scheduleId string, disabled bool) *config.ConfigObject {
+	return &config.ConfigObject{
+		Id:   id,
+		Kind: config.Kind_crawlJob,
+		Meta: &config.Meta{Name: "job " + id},
+		Spec: &config.ConfigObject_CrawlJob{CrawlJob: &config.CrawlJob{
+			ScheduleRef: &config.ConfigRef{Kind: config.Kind_crawlScheduleConfig, Id: scheduleId},
+			Disabled:    disabled,
+		}},
+	}
+}
+
+func crawlSchedule(t *testing.T, id string, cronExpression string, validTo time.Time) *config.ConfigObject {
+	t.Helper()
+	scheduleConfig := &config.CrawlScheduleConfig{CronExpression: cronExpression}
+	if !validTo.IsZero() {
+		timestamp, err := ptypes.TimestampProto(validTo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scheduleConfig.ValidTo = timestamp
+	}
+	return &config.ConfigObject{
+		Id:   id,
+		Kind: config.Kind_crawlScheduleConfig,
+		Spec: &config.ConfigObject_CrawlScheduleConfig{CrawlScheduleConfig: scheduleConfig},
+	}
+}
+
+func jobExecution(t *testing.T, jobId string, startTime time.Time) *frontier.JobExecutionStatus {
+	t.Helper()
+	timestamp, err := ptypes.TimestampProto(startTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &frontier.JobExecutionStatus{Id: "jes-" + jobId, JobId: jobId, StartTime: timestamp}
+}
+
+func TestScheduleComponent(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 30, 0, 0, time.UTC)
+	at := func(hour, min, sec int) time.Time {
+		return time.Date(2021, 3, 1, hour, min, sec, 0, time.UTC)
+	}
+	fake := &scheduleController{
+		crawlJobs: []*config.ConfigObject{
+			crawlJob("started", "at10", false),
+			crawlJob("startedEarly", "at1020", false),
+			crawlJob("startedBefore", "at10", false),
+			crawlJob("running", "at9", false),
+			crawlJob("overdue", "at1015", false),
+			crawlJob("missed", "at8", false),
+			crawlJob("disabled", "at8", true),
+			crawlJob("unscheduled", "", false),
+			crawlJob("expired", "expired", false),
+			crawlJob("yearly", "yearly", false),
+			crawlJob("unknownSchedule", "unknown", false),
+			crawlJob("invalidSchedule", "invalid", false),
+		},
+		schedules: []*config.ConfigObject{
+			crawlSchedule(t, "at8", "0 8 * * *", time.Time{}),
+			crawlSchedule(t, "at9", "0 9 * * *", time.Time{}),
+			crawlSchedule(t, "at10", "0 10 * * *", time.Time{}),
+			crawlSchedule(t, "at1015", "15 10 * * *", time.Time{}),
+			crawlSchedule(t, "at1020", "20 10 * * *", time.Time{}),
+			crawlSchedule(t, "expired", "0 8 * * *", at(7, 0, 0)),
+			crawlSchedule(t, "yearly", "0 0 1 1 *", time.Time{}),
+			crawlSchedule(t, "invalid", "0 25 * * *", time.Time{}),
+		},
+		jobExecutions: []*frontier.JobExecutionStatus{
+			jobExecution(t, "started", at(9, 0, 0)),
+			jobExecution(t, "started", at(10, 0, 30)),
+			jobExecution(t, "startedEarly", at(10, 19, 30)),
+			jobExecution(t, "startedBefore", at(9, 0, 0)),
+		},
+	}
+	hc := &HealthChecker{controllerClient: fake, now: func() time.Time { return now }}
+	options := ScheduleOptions{Window: 24 * time.Hour, WarnAfter: 10 * time.Minute, FailAfter: time.Hour}
+	c, err := hc.scheduleComponent(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps := Results{VeidemannJobs: {Results: []*Result{{Value: JobExecution{JobExecutionId: "jes-running", JobId: "running"}}}}}
+
+	results := make(map[string]*Result)
+	for _, result := range c.checkers[0](context.Background(), deps) {
+		results[result.Id] = result
+	}
+
+	if want := now.Add(-options.Window - scheduleTolerance); !fake.startedSince.Equal(want) {
+		t.Errorf("expected job executions started since %v, got %v", want, fake.startedSince)
+	}
+
+	tests := []struct {
+		jobId  string
+		status Status
+		err    error
+	}{
+		{"started", StatusPass, nil},
+		{"startedEarly", StatusPass, nil},
+		{"startedBefore", StatusWarning, errOverdue},
+		{"running", StatusPass, nil},
+		{"overdue", StatusWarning, errOverdue},
+		{"missed", StatusFail, errMissed},
+	}
+	for _, test := range tests {
+		result, ok := results[test.jobId]
+		if !ok {
+			t.Errorf("%s: missing result", test.jobId)
+			continue
+		}
+		if result.Status != test.status || !errors.Is(result.Err, test.err) {
+			t.Errorf("%s: expected %v (%v), got %v (%v)", test.jobId, test.status, test.err, result.Status, result.Err)
+		}
+	}
+	for _, jobId := range []string{"unknownSchedule", "invalidSchedule"} {
+		if result, ok := results[jobId]; !ok || result.Status != StatusWarning || result.Err == nil {
+			t.Errorf("%s: expected warning, got %+v", jobId, result)
+		}
+	}
+	for _, jobId := range []string{"disabled", "unscheduled", "expired", "yearly"} {
+		if result, ok := results[jobId]; ok {
+			t.Errorf("%s: expected no result, got %+v", jobId, result)
+		}
+	}
+	if len(results) != len(tests)+2 {
+		t.Errorf("expected %d results, got %d", len(tests)+2, len(results))
+	}
+
+	started := results["started"].Value.(ScheduledJob)
+	if started.ScheduledTime != "2021-03-01T10:00:00Z" || started.StartTime != "2021-03-01T10:00:30Z" || started.JobName != "job started" {
+		t.Errorf("unexpected scheduled job: %+v", started)
+	}
+
+	status := Results{VeidemannSchedule: {Results: c.checkers[0](context.Background(), deps)}}.scheduleStatus()
+	if status != StatusFail {
+		t.Errorf("expected schedule status %v, got %v", StatusFail, status)
+	}
+
+	// missed jobs only warn while the crawler is paused
+	for _, runStatus := range []controllerApi.RunStatus{controllerApi.RunStatus_PAUSED, controllerApi.RunStatus_PAUSE_REQUESTED} {
+		deps[VeidemannCrawlerStatus] = &CheckResult{Results: []*Result{{Value: runStatus}}}
+		results := make(map[string]*Result)
+		for _, result := range c.checkers[0](context.Background(), deps) {
+			results[result.Id] = result
+		}
+		if result := results["missed"]; result.Status != StatusWarning || !errors.Is(result.Err, errMissed) {
+			t.Errorf("%s: expected missed job to warn, got %v (%v)", runStatus, result.Status, result.Err)
+		}
+		if result := results["overdue"]; result.Status != StatusWarning || !errors.Is(result.Err, errOverdue) {
+			t.Errorf("%s: expected overdue job to warn, got %v (%v)", runStatus, result.Status, result.Err)
+		}
+		if result := results["started"]; result.Status != StatusPass {
+			t.Errorf("%s: expected started job to pass, got %v", runStatus, result.Status)
+		}
+	}
+	deps[VeidemannCrawlerStatus] = &CheckResult{Results: []*Result{{Value: controllerApi.RunStatus_RUNNING}}}
+	results = make(map[string]*Result)
+	for _, result := range c.checkers[0](context.Background(), deps) {
+		results[result.Id] = result
+	}
+	if result := results["missed"]; result.Status != StatusFail {
+		t.Errorf("expected missed job of running crawler to fail, got %v", result.Status)
+	}
+}
+
+func TestScheduleComponentOverdueBecomesMissed(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	fake := &scheduleController{
+		crawlJobs: []*config.ConfigObject{crawlJob("job", "at10", false)},
+		schedules: []*config.ConfigObject{crawlSchedule(t, "at10", "0 10 * * *", time.Time{})},
+	}
+	hc := &HealthChecker{controllerClient: fake, now: func() time.Time { return now }}
+	c, err := hc.scheduleComponent(ScheduleOptions{Window: 2 * time.Hour, WarnAfter: 10 * time.Minute, FailAfter: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		elapsed time.Duration
+		status  Status
+		err     error
+	}{
+		{0, StatusPass, nil},
+		{10*time.Minute - time.Second, StatusPass, nil},
+		{10 * time.Minute, StatusWarning, errOverdue},
+		{time.Hour - time.Second, StatusWarning, errOverdue},
+		{time.Hour, StatusFail, errMissed},
+		{2*time.Hour - time.Second, StatusFail, errMissed},
+	}
+	for _, test := range tests {
+		now = time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC).Add(test.elapsed)
+		result := c.checkers[0](context.Background(), Results{})[0]
+		if result.Status != test.status || !errors.Is(result.Err, test.err) {
+			t.Errorf("after %v: expected %v (%v), got %v (%v)", test.elapsed, test.status, test.err, result.Status, result.Err)
+		}
+	}
+
+	// the job is started
+	fake.jobExecutions = []*frontier.JobExecutionStatus{jobExecution(t, "job", now)}
+	if result := c.checkers[0](context.Background(), Results{})[0]; result.Status != StatusPass || result.Err != nil {
+		t.Errorf("expected started job, got %v (%v)", result.Status, result.Err)
+	}
+
+	fake.jobExecutionErr = errors.New("unavailable")
+	if result := c.checkers[0](context.Background(), Results{})[0]; result.Status != StatusWarning || result.Err != fake.jobExecutionErr {
+		t.Errorf("expected error of controller, got %v (%v)", result.Status, result.Err)
+	}
+}
+
+func TestScheduleOptions(t *testing.T) {
+	hc := &HealthChecker{}
+	for _, options := range []ScheduleOptions{
+		{},
+		{Window: time.Hour, WarnAfter: time.Hour, FailAfter: time.Minute},
+	} {
+		if _, err := hc.scheduleComponent(options); err == nil {
+			t.Errorf("expected error for %+v", options)
+		}
+	}
+}
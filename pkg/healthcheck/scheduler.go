@@ -0,0 +1,325 @@
+package healthcheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SchedulerOptions struct {
+	// Interval is the default interval between refreshes of a component.
+	Interval time.Duration
+	// Intervals overrides Interval for the components with the given ids.
+	Intervals map[string]time.Duration
+	// StaleLimit is the age after which a result is flagged as stale.
+	// If zero the limit is twice the refresh interval of the component.
+	StaleLimit time.Duration
+}
+
+// Scheduler refreshes the results of a HealthChecker in the background and keeps
+// the last result of every component in memory.
+type Scheduler struct {
+	mu         sync.RWMutex
+	hc         *HealthChecker
+	intervals  map[string]time.Duration
+	staleLimit time.Duration
+	results    Results
+
+	observeMu sync.Mutex
+	observers []checkObserver
+	forget    []func(id string)
+
+	filters []func(*CheckResult) *CheckResult
+
+	// now returns the current time. It is replaced by a fake clock in tests.
+	now func() time.Time
+
+	// runMu serializes Start, Reload and Stop
+	runMu sync.Mutex
+	// done stops the refresh loops of the current health checker
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewScheduler creates a new scheduler for the given health checker.
+func NewScheduler(hc *HealthChecker, options SchedulerOptions) (*Scheduler, error) {
+	intervals, err := intervalsOf(hc, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Scheduler{
+		hc:         hc,
+		intervals:  intervals,
+		staleLimit: options.StaleLimit,
+		results:    make(Results),
+		now:        time.Now,
+	}, nil
+}
+
+// intervalsOf returns the refresh interval of every component of hc.
+func intervalsOf(hc *HealthChecker, options SchedulerOptions) (map[string]time.Duration, error) {
+	if options.Interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive: %v", options.Interval)
+	}
+
+	intervals := make(map[string]time.Duration, len(hc.components))
+	for _, c := range hc.components {
+		intervals[c.id] = options.Interval
+	}
+	for id, interval := range options.Intervals {
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval of component %s must be positive: %v", id, interval)
+		}
+		// configuration keys may have been lower cased, and an id without target
+		// applies to the component of every target
+		found := false
+		for _, c := range hc.components {
+			if strings.EqualFold(c.id, id) || strings.EqualFold(hc.untargeted(c.id), id) {
+				intervals[c.id] = interval
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown component: %s", id)
+		}
+	}
+	return intervals, nil
+}
+
+// Observe registers an observer that is called with every new result.
+// Calls to observers are serialized. Observe must be called before Start.
+func (s *Scheduler) Observe(observer checkObserver) {
+	s.observers = append(s.observers, observer)
+}
+
+// Forget registers a function that is called with the id of every component
+// that is removed by Reload, e.g. to delete state kept by an observer. Calls
+// are serialized with calls to observers. Forget must be called before Start.
+func (s *Scheduler) Forget(forget func(id string)) {
+	s.forget = append(s.forget, forget)
+}
+
+// Filter registers a function that is applied to every result before it is
+// passed to observers or returned by Snapshot. The stored result, which is
+// passed to dependent components, is not filtered. A filter must return a new
+// result instead of modifying its argument. Filter must be called before Start.
+func (s *Scheduler) Filter(filter func(*CheckResult) *CheckResult) {
+	s.filters = append(s.filters, filter)
+}
+
+func (s *Scheduler) filter(checkResult *CheckResult) *CheckResult {
+	for _, filter := range s.filters {
+		checkResult = filter(checkResult)
+	}
+	return checkResult
+}
+
+// Start runs all checks once and then refreshes every component on its own
+// interval until Stop is called.
+func (s *Scheduler) Start() {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	s.start()
+}
+
+// start runs the checks of the current health checker. The caller must hold runMu.
+func (s *Scheduler) start() {
+	s.mu.RLock()
+	hc := s.hc
+	intervals := s.intervals
+	s.mu.RUnlock()
+
+	hc.RunChecks(s.store)
+
+	done := make(chan struct{})
+	s.done = done
+	for _, c := range hc.components {
+		s.wg.Add(1)
+		go func(c component, interval time.Duration) {
+			defer s.wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					// a tick may be ready at the same time as done
+					select {
+					case <-done:
+						return
+					default:
+					}
+					s.store(hc.runComponent(c, s.dependencies(c)))
+				}
+			}
+		}(c, intervals[c.id])
+	}
+}
+
+// Stop stops refreshing and waits for running checks to finish.
+func (s *Scheduler) Stop() {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	s.wg.Wait()
+}
+
+// Reload replaces the health checker and the refresh intervals. Checks that are
+// running finish on the old health checker before the new one is used, and the
+// last results are served until the new health checker has run all checks once.
+// The results of components that are removed are forgotten.
+// The old health checker is returned so it can be closed.
+func (s *Scheduler) Reload(hc *HealthChecker, options SchedulerOptions) (*HealthChecker, error) {
+	intervals, err := intervalsOf(hc, options)
+	if err != nil {
+		return nil, err
+	}
+
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	if s.done == nil {
+		return nil, fmt.Errorf("scheduler is not running")
+	}
+	close(s.done)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	old := s.hc
+	var removed []string
+	for id := range s.intervals {
+		if _, ok := intervals[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	s.hc = hc
+	s.intervals = intervals
+	s.staleLimit = options.StaleLimit
+	// forget the results of removed components
+	for _, id := range removed {
+		delete(s.results, id)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(removed)
+	s.observeMu.Lock()
+	for _, id := range removed {
+		for _, forget := range s.forget {
+			forget(id)
+		}
+	}
+	s.observeMu.Unlock()
+
+	s.start()
+	return old, nil
+}
+
+// HealthChecker returns the current health checker.
+func (s *Scheduler) HealthChecker() *HealthChecker {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hc
+}
+
+// Snapshot calls observer with the last result of every component.
+// Results older than the stale limit are flagged as stale.
+func (s *Scheduler) Snapshot(observer checkObserver) {
+	s.snapshot(observer, func(string) bool { return true })
+}
+
+// ComponentSnapshot returns a function like Snapshot that only observes the
+// result of the component with the given id, or false if there is no such component.
+func (s *Scheduler) ComponentSnapshot(id string) (func(checkObserver), bool) {
+	s.mu.RLock()
+	_, ok := s.intervals[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return func(observer checkObserver) {
+		s.snapshot(observer, func(componentId string) bool { return componentId == id })
+	}, true
+}
+
+// TargetSnapshot returns a function like Snapshot that only observes the
+// results of the components of the target with the given name, or false if
+// there is no such target.
+func (s *Scheduler) TargetSnapshot(name string) (func(checkObserver), bool) {
+	prefix := name + TargetSeparator
+	found := false
+	s.mu.RLock()
+	for id := range s.intervals {
+		if strings.HasPrefix(id, prefix) {
+			found = true
+			break
+		}
+	}
+	s.mu.RUnlock()
+	if !found {
+		return nil, false
+	}
+	return func(observer checkObserver) {
+		s.snapshot(observer, func(componentId string) bool { return strings.HasPrefix(componentId, prefix) })
+	}, true
+}
+
+func (s *Scheduler) snapshot(observer checkObserver, include func(id string) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	for _, c := range s.hc.components {
+		if !include(c.id) {
+			continue
+		}
+		checkResult, ok := s.results[c.id]
+		if !ok {
+			continue
+		}
+		snapshot := *checkResult
+		snapshot.Stale = now.Sub(checkResult.Time) > s.staleLimitOf(c.id)
+		observer(s.filter(&snapshot))
+	}
+}
+
+func (s *Scheduler) store(checkResult *CheckResult) {
+	s.mu.Lock()
+	s.results[checkResult.Name] = checkResult
+	s.mu.Unlock()
+
+	checkResult = s.filter(checkResult)
+
+	s.observeMu.Lock()
+	defer s.observeMu.Unlock()
+	for _, observer := range s.observers {
+		observer(checkResult)
+	}
+}
+
+// dependencies returns the last results of the components c depends on.
+func (s *Scheduler) dependencies(c component) Results {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deps := make(Results, len(c.dependsOn))
+	for _, id := range c.dependsOn {
+		deps[id] = s.results[id]
+	}
+	return deps
+}
+
+func (s *Scheduler) staleLimitOf(id string) time.Duration {
+	if s.staleLimit > 0 {
+		return s.staleLimit
+	}
+	return 2 * s.intervals[id]
+}
@@ -0,0 +1,358 @@
+package healthcheck
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// counter counts the checks of a stub component.
+type counter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *counter) get() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+// countingComponent returns a component that passes with the number of times it has been checked.
+func countingComponent(id string, c *counter) component {
+	return component{
+		id: id,
+		checkers: []checker{
+			single(func(context.Context, Results) *Result {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				c.n++
+				return &Result{Status: StatusPass, Value: c.n}
+			}),
+		},
+	}
+}
+
+// snapshotIds returns the ids of the components observed by snapshot.
+func snapshotIds(snapshot func(checkObserver)) []string {
+	var ids []string
+	snapshot(func(checkResult *CheckResult) {
+		ids = append(ids, checkResult.Name)
+	})
+	sort.Strings(ids)
+	return ids
+}
+
+func TestIntervalsOf(t *testing.T) {
+	single := &HealthChecker{components: []component{
+		testComponent(VeidemannDashboard, ""),
+		testComponent(VeidemannJobs, ""),
+	}}
+	targets, err := Combine(map[string]*HealthChecker{
+		"a": {components: []component{testComponent(VeidemannDashboard, "")}},
+		"b": {components: []component{testComponent(VeidemannDashboard, "")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		hc        *HealthChecker
+		options   SchedulerOptions
+		intervals map[string]time.Duration
+	}{
+		{"default", single, SchedulerOptions{Interval: time.Minute}, map[string]time.Duration{
+			VeidemannDashboard: time.Minute,
+			VeidemannJobs:      time.Minute,
+		}},
+		{"override", single, SchedulerOptions{Interval: time.Minute, Intervals: map[string]time.Duration{VeidemannJobs: time.Second}}, map[string]time.Duration{
+			VeidemannDashboard: time.Minute,
+			VeidemannJobs:      time.Second,
+		}},
+		// configuration keys may be lower cased
+		{"case insensitive", single, SchedulerOptions{Interval: time.Minute, Intervals: map[string]time.Duration{"veidemann:Dashboard": time.Hour}}, map[string]time.Duration{
+			VeidemannDashboard: time.Hour,
+			VeidemannJobs:      time.Minute,
+		}},
+		{"every target", targets, SchedulerOptions{Interval: time.Minute, Intervals: map[string]time.Duration{VeidemannDashboard: time.Second}}, map[string]time.Duration{
+			"a/" + VeidemannDashboard: time.Second,
+			"b/" + VeidemannDashboard: time.Second,
+		}},
+		{"one target", targets, SchedulerOptions{Interval: time.Minute, Intervals: map[string]time.Duration{"b/" + VeidemannDashboard: time.Second}}, map[string]time.Duration{
+			"a/" + VeidemannDashboard: time.Minute,
+			"b/" + VeidemannDashboard: time.Second,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			intervals, err := intervalsOf(test.hc, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(intervals, test.intervals) {
+				t.Errorf("expected %v, got %v", test.intervals, intervals)
+			}
+		})
+	}
+
+	for name, options := range map[string]SchedulerOptions{
+		"no interval":           {},
+		"negative interval":     {Interval: -time.Minute},
+		"unknown component":     {Interval: time.Minute, Intervals: map[string]time.Duration{"veidemann:unknown": time.Second}},
+		"non-positive override": {Interval: time.Minute, Intervals: map[string]time.Duration{VeidemannJobs: 0}},
+	} {
+		if _, err := intervalsOf(single, options); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSchedulerRefreshesOnInterval(t *testing.T) {
+	fast, slow := &counter{}, &counter{}
+	hc := &HealthChecker{components: []component{
+		countingComponent("fast", fast),
+		countingComponent("slow", slow),
+	}}
+	s, err := NewScheduler(hc, SchedulerOptions{Interval: time.Hour, Intervals: map[string]time.Duration{"fast": 5 * time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Start()
+	// every component is checked once when the scheduler starts
+	if fast.get() != 1 || slow.get() != 1 {
+		t.Errorf("expected every component to be checked at start, got %d and %d", fast.get(), slow.get())
+	}
+	for deadline := time.Now().Add(5 * time.Second); fast.get() < 4; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected fast component to be refreshed, got %d checks", fast.get())
+		}
+	}
+	s.Stop()
+
+	stopped := fast.get()
+	time.Sleep(20 * time.Millisecond)
+	if fast.get() != stopped {
+		t.Errorf("expected no checks after stop")
+	}
+	if slow.get() != 1 {
+		t.Errorf("expected slow component to be checked once, got %d", slow.get())
+	}
+}
+
+func TestSchedulerStale(t *testing.T) {
+	hc := &HealthChecker{components: []component{
+		countingComponent("fast", &counter{}),
+		countingComponent("slow", &counter{}),
+	}}
+	options := SchedulerOptions{Interval: time.Hour, Intervals: map[string]time.Duration{"fast": time.Minute}}
+	s, err := NewScheduler(hc, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	defer s.Stop()
+
+	// both components are checked at the same time
+	checked := time.Now()
+	s.mu.Lock()
+	for _, checkResult := range s.results {
+		checkResult.Time = checked
+	}
+	s.mu.Unlock()
+	var now time.Time
+	s.now = func() time.Time { return now }
+	stale := func() map[string]bool {
+		stale := make(map[string]bool)
+		s.Snapshot(func(checkResult *CheckResult) {
+			stale[checkResult.Name] = checkResult.Stale
+		})
+		return stale
+	}
+
+	// a result is stale after twice the interval of its component
+	tests := []struct {
+		age   time.Duration
+		fast  bool
+		slow  bool
+		limit time.Duration
+	}{
+		{0, false, false, 0},
+		{2 * time.Minute, false, false, 0},
+		{2*time.Minute + time.Second, true, false, 0},
+		{2 * time.Hour, true, false, 0},
+		{2*time.Hour + time.Second, true, true, 0},
+		// the stale limit overrides the intervals
+		{10 * time.Minute, false, false, 10 * time.Minute},
+		{10*time.Minute + time.Second, true, true, 10 * time.Minute},
+	}
+	for _, test := range tests {
+		now = checked.Add(test.age)
+		s.staleLimit = test.limit
+		got := stale()
+		if got["fast"] != test.fast || got["slow"] != test.slow {
+			t.Errorf("after %v with stale limit %v: expected fast %v and slow %v, got %v", test.age, test.limit, test.fast, test.slow, got)
+		}
+	}
+}
+
+func TestComponentAndTargetSnapshot(t *testing.T) {
+	hc, err := Combine(map[string]*HealthChecker{
+		"a": newTestTarget("a"),
+		"b": newTestTarget("b"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewScheduler(hc, SchedulerOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// filters are applied to snapshots
+	s.Filter(func(checkResult *CheckResult) *CheckResult {
+		filtered := *checkResult
+		filtered.Name = strings.ToUpper(checkResult.Name)
+		return &filtered
+	})
+	s.Start()
+	defer s.Stop()
+
+	if got := snapshotIds(s.Snapshot); !reflect.DeepEqual(got, []string{"A/DEP", "A/USER", "B/DEP", "B/USER"}) {
+		t.Errorf("unexpected snapshot: %v", got)
+	}
+
+	snapshot, ok := s.ComponentSnapshot("b/user")
+	if !ok {
+		t.Fatal("expected component b/user")
+	}
+	if got := snapshotIds(snapshot); !reflect.DeepEqual(got, []string{"B/USER"}) {
+		t.Errorf("expected only b/user, got %v", got)
+	}
+	snapshot, ok = s.TargetSnapshot("a")
+	if !ok {
+		t.Fatal("expected target a")
+	}
+	if got := snapshotIds(snapshot); !reflect.DeepEqual(got, []string{"A/DEP", "A/USER"}) {
+		t.Errorf("expected the components of a, got %v", got)
+	}
+
+	for _, id := range []string{"user", "c/user", "B/USER"} {
+		if _, ok := s.ComponentSnapshot(id); ok {
+			t.Errorf("expected no component %s", id)
+		}
+	}
+	for _, name := range []string{"c", "a/dep", "", "A"} {
+		if _, ok := s.TargetSnapshot(name); ok {
+			t.Errorf("expected no target %q", name)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	// the old component blocks in its second check until it is released,
+	// and kept depends on it so the first results are stored in order
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var checks int
+	old := &HealthChecker{components: []component{
+		{
+			id: "old",
+			checkers: []checker{single(func(context.Context, Results) *Result {
+				checks++
+				if checks == 2 {
+					close(started)
+					<-release
+				}
+				return &Result{Status: StatusPass, Value: "old"}
+			})},
+		},
+		testComponent("kept", "old", "old"),
+	}}
+	s, err := NewScheduler(old, SchedulerOptions{Interval: time.Hour, Intervals: map[string]time.Duration{"old": time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var events []string
+	s.Observe(func(checkResult *CheckResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, checkResult.Name+"="+checkResult.Results[0].Value.(string))
+	})
+	s.Forget(func(id string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, "forget "+id)
+	})
+	s.Start()
+	defer s.Stop()
+	<-started
+
+	hc := &HealthChecker{components: []component{
+		testComponent("kept", "new"),
+		testComponent("new", "new", "kept"),
+	}}
+	reloaded := make(chan *HealthChecker)
+	go func() {
+		old, err := s.Reload(hc, SchedulerOptions{Interval: time.Hour})
+		if err != nil {
+			t.Error(err)
+		}
+		reloaded <- old
+	}()
+
+	// the running check finishes on the old health checker before the new one is used
+	select {
+	case <-reloaded:
+		t.Fatal("expected reload to wait for the running check")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if got := snapshotIds(s.Snapshot); !reflect.DeepEqual(got, []string{"kept", "old"}) {
+		t.Errorf("expected the last results to be served during reload, got %v", got)
+	}
+	close(release)
+	if got := <-reloaded; got != old {
+		t.Errorf("expected the old health checker to be returned")
+	}
+
+	if s.HealthChecker() != hc {
+		t.Errorf("expected the new health checker")
+	}
+	if got := snapshotIds(s.Snapshot); !reflect.DeepEqual(got, []string{"kept", "new"}) {
+		t.Errorf("expected the results of the new health checker, got %v", got)
+	}
+	if _, ok := s.ComponentSnapshot("old"); ok {
+		t.Errorf("expected the removed component to be forgotten")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the results of the new health checker follow the last result of the old one
+	// and the removal of its components, and dependencies are checked first
+	want := []string{"old=old", "kept=old(old)", "old=old", "forget old", "kept=new", "new=new(new)"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("expected %v, got %v", want, events)
+	}
+}
+
+func TestReloadErrors(t *testing.T) {
+	hc := &HealthChecker{components: []component{testComponent("a", "")}}
+	s, err := NewScheduler(hc, SchedulerOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reload(hc, SchedulerOptions{Interval: time.Hour}); err == nil {
+		t.Error("expected error when the scheduler is not running")
+	}
+	s.Start()
+	defer s.Stop()
+	if _, err := s.Reload(hc, SchedulerOptions{}); err == nil {
+		t.Error("expected error for invalid options")
+	}
+}
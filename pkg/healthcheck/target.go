@@ -0,0 +1,75 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TargetSeparator separates the name of a target from the component id in the
+// ids of the components of a combined health checker, e.g. "webarchive/veidemann:harvest".
+const TargetSeparator = "/"
+
+// Combine returns a health checker that checks the components of every target
+// health checker. The ids of the components are prefixed with the name of the
+// target. Closing the returned health checker closes the target health checkers.
+func Combine(targets map[string]*HealthChecker) (*HealthChecker, error) {
+	var names []string
+	for name := range targets {
+		if name == "" || strings.Contains(name, TargetSeparator) {
+			return nil, fmt.Errorf("invalid target name: %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hc := &HealthChecker{now: time.Now}
+	for _, name := range names {
+		target := targets[name]
+		hc.targets = append(hc.targets, target)
+		for _, c := range target.components {
+			hc.components = append(hc.components, namespaced(name, c))
+		}
+	}
+	if err := validateComponents(hc.components); err != nil {
+		return nil, err
+	}
+	return hc, nil
+}
+
+// namespaced returns c with the id and dependencies prefixed with the name of
+// the target. The checkers get the results of the dependencies by their original ids.
+func namespaced(target string, c component) component {
+	prefix := target + TargetSeparator
+
+	dependsOn := make([]string, len(c.dependsOn))
+	for i, id := range c.dependsOn {
+		dependsOn[i] = prefix + id
+	}
+	checkers := make([]checker, len(c.checkers))
+	for i, check := range c.checkers {
+		check := check
+		checkers[i] = func(ctx context.Context, deps Results) []*Result {
+			targetDeps := make(Results, len(deps))
+			for id, dep := range deps {
+				targetDeps[strings.TrimPrefix(id, prefix)] = dep
+			}
+			return check(ctx, targetDeps)
+		}
+	}
+	return component{
+		id:        prefix + c.id,
+		dependsOn: dependsOn,
+		checkers:  checkers,
+	}
+}
+
+// untargeted returns the component id without the target name if hc combines targets.
+func (hc *HealthChecker) untargeted(id string) string {
+	if len(hc.targets) == 0 {
+		return id
+	}
+	return id[strings.Index(id, TargetSeparator)+1:]
+}
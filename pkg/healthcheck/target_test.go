@@ -0,0 +1,164 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testComponent returns a component with a result with value, followed by the
+// values of the dependencies the checker is passed, e.g. "user(dep)".
+func testComponent(id string, value string, dependsOn ...string) component {
+	return component{
+		id:        id,
+		dependsOn: dependsOn,
+		checkers: []checker{
+			single(func(_ context.Context, deps Results) *Result {
+				var values []string
+				for _, dep := range dependsOn {
+					values = append(values, fmt.Sprint(deps.value(dep)))
+				}
+				if len(values) == 0 {
+					return &Result{Status: StatusPass, Value: value}
+				}
+				return &Result{Status: StatusPass, Value: value + "(" + strings.Join(values, ",") + ")"}
+			}),
+		},
+	}
+}
+
+func newTestTarget(value string) *HealthChecker {
+	return &HealthChecker{
+		now: time.Now,
+		components: []component{
+			testComponent("dep", value),
+			testComponent("user", "user", "dep"),
+		},
+	}
+}
+
+func TestCombine(t *testing.T) {
+	tests := []struct {
+		name       string
+		targets    map[string]*HealthChecker
+		ids        []string
+		dependsOn  map[string][]string
+		untargeted map[string]string
+	}{
+		{
+			name:    "single target",
+			targets: map[string]*HealthChecker{"a": newTestTarget("a")},
+			ids:     []string{"a/dep", "a/user"},
+			dependsOn: map[string][]string{
+				"a/dep":  {},
+				"a/user": {"a/dep"},
+			},
+			untargeted: map[string]string{"a/dep": "dep", "a/user": "user"},
+		},
+		{
+			name: "targets are ordered by name",
+			targets: map[string]*HealthChecker{
+				"webarchive": newTestTarget("b"),
+				"newscrawl":  newTestTarget("a"),
+			},
+			ids: []string{"newscrawl/dep", "newscrawl/user", "webarchive/dep", "webarchive/user"},
+			dependsOn: map[string][]string{
+				"newscrawl/user":  {"newscrawl/dep"},
+				"webarchive/user": {"webarchive/dep"},
+			},
+			untargeted: map[string]string{"newscrawl/user": "user", "webarchive/dep": "dep"},
+		},
+		{
+			name: "component ids with separator",
+			targets: map[string]*HealthChecker{"a": {now: time.Now, components: []component{
+				testComponent("x/dep", "x"),
+				testComponent("user", "user", "x/dep"),
+			}}},
+			ids:        []string{"a/x/dep", "a/user"},
+			dependsOn:  map[string][]string{"a/user": {"a/x/dep"}},
+			untargeted: map[string]string{"a/x/dep": "x/dep"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hc, err := Combine(test.targets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, c := range hc.components {
+				ids = append(ids, c.id)
+				if want, ok := test.dependsOn[c.id]; ok && len(want)+len(c.dependsOn) > 0 && !reflect.DeepEqual(c.dependsOn, want) {
+					t.Errorf("expected %s to depend on %v, got %v", c.id, want, c.dependsOn)
+				}
+			}
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Errorf("expected components %v, got %v", test.ids, ids)
+			}
+			for id, want := range test.untargeted {
+				if got := hc.untargeted(id); got != want {
+					t.Errorf("expected %s without target to be %s, got %s", id, want, got)
+				}
+			}
+			if len(hc.targets) != len(test.targets) {
+				t.Errorf("expected %d targets, got %d", len(test.targets), len(hc.targets))
+			}
+		})
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	for _, name := range []string{"", "news/crawl"} {
+		if _, err := Combine(map[string]*HealthChecker{name: newTestTarget("a")}); err == nil {
+			t.Errorf("expected error for target name %q", name)
+		}
+	}
+}
+
+// TestCombinedDependencies checks that every target's components get the
+// results of the dependencies of the same target by their original ids.
+func TestCombinedDependencies(t *testing.T) {
+	hc, err := Combine(map[string]*HealthChecker{
+		"a": newTestTarget("a"),
+		"b": newTestTarget("b"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	values := make(map[string]Value)
+	hc.RunChecks(func(checkResult *CheckResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		values[checkResult.Name] = checkResult.Results[0].Value
+	})
+	want := map[string]Value{
+		"a/dep":  "a",
+		"a/user": "user(a)",
+		"b/dep":  "b",
+		"b/user": "user(b)",
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+
+	// the scheduler passes the results of the dependencies the same way
+	s, err := NewScheduler(hc, SchedulerOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.results["a/dep"] = &CheckResult{Name: "a/dep", Results: []*Result{{Value: "a2"}}}
+	s.results["b/dep"] = &CheckResult{Name: "b/dep", Results: []*Result{{Value: "b2"}}}
+	for _, c := range hc.components {
+		if c.id == "b/user" {
+			if got := hc.runComponent(c, s.dependencies(c)).Results[0].Value; got != "user(b2)" {
+				t.Errorf("expected user(b2), got %v", got)
+			}
+		}
+	}
+}
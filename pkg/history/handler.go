@@ -0,0 +1,85 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// the default length of the requested period
+const defaultPeriod = time.Hour
+
+// Timeline is the response of the history endpoint.
+type Timeline struct {
+	ComponentId string       `json:"componentId,omitempty"`
+	Since       time.Time    `json:"since"`
+	Until       time.Time    `json:"until"`
+	Transitions []Transition `json:"transitions"`
+	Snapshots   []Snapshot   `json:"snapshots"`
+}
+
+// parseTime parses a time given as an RFC 3339 timestamp or as a duration
+// before now, e.g. "10m".
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %q", s)
+}
+
+// Handler returns a handler that responds with the timeline of the period given
+// by the query parameters "since" and "until", by default the last hour. The
+// query parameter "component" limits the timeline to one component.
+func (h *History) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		now := time.Now()
+		timeline := Timeline{
+			ComponentId: query.Get("component"),
+			Until:       now,
+		}
+		var err error
+		if until := query.Get("until"); until != "" {
+			if timeline.Until, err = parseTime(until, now); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		timeline.Since = timeline.Until.Add(-defaultPeriod)
+		if since := query.Get("since"); since != "" {
+			if timeline.Since, err = parseTime(since, now); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if timeline.Since.After(timeline.Until) {
+			http.Error(w, "since is after until", http.StatusBadRequest)
+			return
+		}
+
+		if timeline.Transitions, err = h.Transitions(timeline.ComponentId, timeline.Since, timeline.Until); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if timeline.Snapshots, err = h.Snapshots(timeline.ComponentId, timeline.Since, timeline.Until); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := json.NewEncoder(w).Encode(timeline); err != nil {
+			log.Println(err)
+		}
+	}
+}
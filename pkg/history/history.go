@@ -0,0 +1,340 @@
+// Package history records health snapshots and component status transitions
+// in an embedded database.
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	snapshotsBucket   = []byte("snapshots")
+	transitionsBucket = []byte("transitions")
+)
+
+// how often records older than the retention are removed
+const pruneInterval = time.Hour
+
+type Options struct {
+	// File is the path of the database file.
+	File string
+	// SnapshotInterval is the interval between recorded snapshots.
+	SnapshotInterval time.Duration
+	// SnapshotRetention is how long snapshots are kept.
+	SnapshotRetention time.Duration
+	// TransitionRetention is how long status transitions are kept.
+	TransitionRetention time.Duration
+}
+
+// Transition is a change of the status of a component.
+type Transition struct {
+	ComponentId    string     `json:"componentId"`
+	PreviousStatus api.Status `json:"previousStatus,omitempty"`
+	Status         api.Status `json:"status"`
+	Output         string     `json:"output,omitempty"`
+	Time           time.Time  `json:"time"`
+}
+
+// Snapshot is the aggregated health at a point in time.
+type Snapshot struct {
+	Time   time.Time  `json:"time"`
+	Health api.Health `json:"health"`
+}
+
+// History records snapshots and status transitions.
+type History struct {
+	options Options
+	db      *bolt.DB
+
+	// previous is the last recorded status of every component
+	previous map[string]api.Status
+
+	// now returns the current time. It is replaced by a fake clock in tests.
+	now func() time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New opens the database and loads the last recorded status of every component.
+func New(options Options) (*History, error) {
+	if options.SnapshotInterval <= 0 {
+		return nil, fmt.Errorf("history snapshot interval must be positive: %v", options.SnapshotInterval)
+	}
+	db, err := bolt.Open(options.File, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	h := &History{
+		options:  options,
+		db:       db,
+		previous: make(map[string]api.Status),
+		now:      time.Now,
+		done:     make(chan struct{}),
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{snapshotsBucket, transitionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(transitionsBucket).ForEach(func(_, v []byte) error {
+			var transition Transition
+			if err := json.Unmarshal(v, &transition); err != nil {
+				return err
+			}
+			h.previous[transition.ComponentId] = transition.Status
+			return nil
+		})
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %w", err)
+	}
+	return h, nil
+}
+
+// key returns a database key that sorts by time.
+func key(t time.Time, suffix string) []byte {
+	k := make([]byte, 8, 8+len(suffix))
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	return append(k, suffix...)
+}
+
+func (h *History) put(bucket []byte, k []byte, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(k, value)
+	})
+}
+
+// Observe records a transition if the status of the component has changed
+// since the last recorded status. Calls to Observe must be serialized.
+func (h *History) Observe(checkResult *healthcheck.CheckResult) {
+	status := healthcheck.ComponentStatus(checkResult)
+	previous, ok := h.previous[checkResult.Name]
+	if ok && previous == status {
+		return
+	}
+	h.previous[checkResult.Name] = status
+
+	transition := Transition{
+		ComponentId:    checkResult.Name,
+		PreviousStatus: previous,
+		Status:         status,
+		Time:           checkResult.Time,
+	}
+	var outputs []string
+	for _, result := range checkResult.Results {
+		if result.Err != nil {
+			outputs = append(outputs, result.Err.Error())
+		}
+	}
+	transition.Output = strings.Join(outputs, "; ")
+
+	if err := h.put(transitionsBucket, key(transition.Time, transition.ComponentId), transition); err != nil {
+		log.Printf("failed to record status transition: %v", err)
+	}
+}
+
+// Start records a snapshot of the health returned by collect every snapshot
+// interval and removes old records until Close is called.
+func (h *History) Start(collect func() *api.Health) {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.prune()
+		snapshotTicker := time.NewTicker(h.options.SnapshotInterval)
+		defer snapshotTicker.Stop()
+		pruneTicker := time.NewTicker(pruneInterval)
+		defer pruneTicker.Stop()
+		for {
+			select {
+			case <-h.done:
+				return
+			case now := <-snapshotTicker.C:
+				h.record(now, collect())
+			case <-pruneTicker.C:
+				h.prune()
+			}
+		}
+	}()
+}
+
+func (h *History) record(now time.Time, health *api.Health) {
+	snapshot := Snapshot{Time: now, Health: *health}
+	if err := h.put(snapshotsBucket, key(now, ""), snapshot); err != nil {
+		log.Printf("failed to record health snapshot: %v", err)
+	}
+}
+
+// prune removes the records that are older than the retention. The last old
+// transition of every component is kept, since it tells the status of the
+// component at the start of the retention period.
+func (h *History) prune() {
+	now := h.now()
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		for bucket, retention := range map[string]time.Duration{
+			string(snapshotsBucket):   h.options.SnapshotRetention,
+			string(transitionsBucket): h.options.TransitionRetention,
+		} {
+			if retention <= 0 {
+				continue
+			}
+			cutoff := key(now.Add(-retention), "")
+			b := tx.Bucket([]byte(bucket))
+			// deleting with the cursor while iterating may skip keys
+			var keys [][]byte
+			last := make(map[string][]byte)
+			c := b.Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+				if bucket == string(transitionsBucket) {
+					componentId := string(k[8:])
+					if previous, ok := last[componentId]; ok {
+						keys = append(keys, previous)
+					}
+					last[componentId] = k
+				} else {
+					keys = append(keys, k)
+				}
+			}
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to remove old history: %v", err)
+	}
+}
+
+// Components returns the ids of the components with recorded transitions.
+func (h *History) Components() ([]string, error) {
+	var componentIds []string
+	err := h.db.View(func(tx *bolt.Tx) error {
+		seen := make(map[string]bool)
+		return tx.Bucket(transitionsBucket).ForEach(func(k, _ []byte) error {
+			componentId := string(k[8:])
+			if !seen[componentId] {
+				seen[componentId] = true
+				componentIds = append(componentIds, componentId)
+			}
+			return nil
+		})
+	})
+	sort.Strings(componentIds)
+	return componentIds, err
+}
+
+// Close stops recording snapshots and closes the database.
+func (h *History) Close() error {
+	close(h.done)
+	h.wg.Wait()
+	return h.db.Close()
+}
+
+// each calls fn with the value of every record in bucket from since until until.
+func (h *History) each(bucket []byte, since, until time.Time, fn func(v []byte) error) error {
+	return h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		end := key(until, "")
+		for k, v := c.Seek(key(since, "")); k != nil && bytes.Compare(k[:8], end) <= 0; k, v = c.Next() {
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Transitions returns the status transitions from since until until, oldest
+// first. If componentId is not empty only transitions of that component are returned.
+func (h *History) Transitions(componentId string, since, until time.Time) ([]Transition, error) {
+	transitions := []Transition{}
+	err := h.each(transitionsBucket, since, until, func(v []byte) error {
+		var transition Transition
+		if err := json.Unmarshal(v, &transition); err != nil {
+			return err
+		}
+		if componentId == "" || transition.ComponentId == componentId {
+			transitions = append(transitions, transition)
+		}
+		return nil
+	})
+	return transitions, err
+}
+
+// LastTransition returns the last status transition of a component before
+// time t, and false if there is none.
+func (h *History) LastTransition(componentId string, t time.Time) (Transition, bool, error) {
+	var last Transition
+	found := false
+	err := h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(transitionsBucket).Cursor()
+		end := key(t, "")
+		k, v := c.Seek(end)
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil; k, v = c.Prev() {
+			if string(k[8:]) != componentId {
+				continue
+			}
+			if err := json.Unmarshal(v, &last); err != nil {
+				return err
+			}
+			found = true
+			return nil
+		}
+		return nil
+	})
+	return last, found, err
+}
+
+// Snapshots returns the snapshots from since until until, oldest first. If
+// componentId is not empty the snapshots only contain the checks of that
+// component, and the status is the status of the component.
+func (h *History) Snapshots(componentId string, since, until time.Time) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	err := h.each(snapshotsBucket, since, until, func(v []byte) error {
+		var snapshot Snapshot
+		if err := json.Unmarshal(v, &snapshot); err != nil {
+			return err
+		}
+		if componentId != "" {
+			checks, ok := snapshot.Health.Checks[componentId]
+			if !ok {
+				return nil
+			}
+			snapshot.Health.Checks = api.Checks{componentId: checks}
+			snapshot.Health.Status = api.StatusHealthy
+			for _, check := range checks {
+				if check.Status.Value() > 0 && check.Status.Value() < snapshot.Health.Status.Value() {
+					snapshot.Health.Status = check.Status
+				}
+			}
+		}
+		snapshots = append(snapshots, snapshot)
+		return nil
+	})
+	return snapshots, err
+}
@@ -0,0 +1,271 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+)
+
+var start = time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+// at returns the time minutes after start.
+func at(minutes int) time.Time {
+	return start.Add(time.Duration(minutes) * time.Minute)
+}
+
+func newTestHistory(t *testing.T, options Options) (*History, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.File = filepath.Join(dir, "history.db")
+	options.SnapshotInterval = time.Minute
+	h, err := New(options)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return h, func() {
+		_ = h.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// observe records the status of a component at time t.
+func observe(h *History, componentId string, status healthcheck.Status, t time.Time) {
+	h.Observe(&healthcheck.CheckResult{
+		Name:    componentId,
+		Results: []*healthcheck.Result{{Status: status}},
+		Time:    t,
+	})
+}
+
+// transitionTimes returns the time of every transition of componentId.
+func transitionTimes(t *testing.T, h *History, componentId string) []time.Time {
+	t.Helper()
+	transitions, err := h.Transitions(componentId, at(-24*60), at(24*60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var times []time.Time
+	for _, transition := range transitions {
+		times = append(times, transition.Time)
+	}
+	return times
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPreviousStatusIsRestored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	options := Options{File: filepath.Join(dir, "history.db"), SnapshotInterval: time.Minute}
+
+	h, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observe(h, "a", healthcheck.StatusPass, at(0))
+	observe(h, "a", healthcheck.StatusPass, at(1))
+	observe(h, "a", healthcheck.StatusFail, at(2))
+	observe(h, "b", healthcheck.StatusWarning, at(3))
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err = New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// the status after a restart is not a transition if it is unchanged
+	observe(h, "a", healthcheck.StatusFail, at(4))
+	observe(h, "b", healthcheck.StatusPass, at(5))
+	if got, want := transitionTimes(t, h, "a"), []time.Time{at(0), at(2)}; !equalTimes(got, want) {
+		t.Errorf("expected transitions of a at %v, got %v", want, got)
+	}
+	transitions, err := h.Transitions("b", at(0), at(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transitions) != 2 || transitions[1].PreviousStatus != api.StatusWarn || transitions[1].Status != api.StatusHealthy {
+		t.Errorf("unexpected transitions of b: %+v", transitions)
+	}
+	if components, err := h.Components(); err != nil || len(components) != 2 || components[0] != "a" || components[1] != "b" {
+		t.Errorf("expected components a and b, got %v %v", components, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	h, cleanup := newTestHistory(t, Options{SnapshotRetention: time.Hour, TransitionRetention: time.Hour})
+	defer cleanup()
+	h.now = func() time.Time { return at(180) }
+
+	observe(h, "a", healthcheck.StatusPass, at(0))
+	observe(h, "a", healthcheck.StatusFail, at(30))
+	observe(h, "a", healthcheck.StatusPass, at(60))
+	observe(h, "a", healthcheck.StatusFail, at(150))
+	observe(h, "b", healthcheck.StatusPass, at(10))
+	observe(h, "c", healthcheck.StatusPass, at(130))
+	for _, minutes := range []int{0, 60, 119, 120, 170} {
+		h.record(at(minutes), &api.Health{Status: api.StatusHealthy})
+	}
+
+	h.prune()
+
+	// the last transition older than the retention is kept
+	for componentId, want := range map[string][]time.Time{
+		"a": {at(60), at(150)},
+		"b": {at(10)},
+		"c": {at(130)},
+	} {
+		if got := transitionTimes(t, h, componentId); !equalTimes(got, want) {
+			t.Errorf("expected transitions of %s at %v, got %v", componentId, want, got)
+		}
+	}
+	snapshots, err := h.Snapshots("", at(0), at(180))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var times []time.Time
+	for _, snapshot := range snapshots {
+		times = append(times, snapshot.Time)
+	}
+	if want := []time.Time{at(120), at(170)}; !equalTimes(times, want) {
+		t.Errorf("expected snapshots at %v, got %v", want, times)
+	}
+}
+
+func TestPruneWithoutRetention(t *testing.T) {
+	h, cleanup := newTestHistory(t, Options{})
+	defer cleanup()
+	h.now = func() time.Time { return at(24 * 60) }
+
+	observe(h, "a", healthcheck.StatusPass, at(0))
+	observe(h, "a", healthcheck.StatusFail, at(1))
+	h.prune()
+
+	if got := transitionTimes(t, h, "a"); len(got) != 2 {
+		t.Errorf("expected transitions to be kept, got %v", got)
+	}
+}
+
+func TestLastTransition(t *testing.T) {
+	h, cleanup := newTestHistory(t, Options{})
+	defer cleanup()
+
+	observe(h, "a", healthcheck.StatusPass, at(10))
+	observe(h, "b", healthcheck.StatusPass, at(20))
+	observe(h, "a", healthcheck.StatusFail, at(30))
+	observe(h, "b", healthcheck.StatusFail, at(40))
+
+	tests := []struct {
+		componentId string
+		t           time.Time
+		last        time.Time
+		found       bool
+	}{
+		{"a", at(0), time.Time{}, false},
+		// a transition at t is not before t
+		{"a", at(10), time.Time{}, false},
+		{"a", at(11), at(10), true},
+		{"a", at(30), at(10), true},
+		{"a", at(31), at(30), true},
+		// the last key in the bucket is of another component
+		{"a", at(60), at(30), true},
+		{"b", at(20), time.Time{}, false},
+		{"b", at(30), at(20), true},
+		{"b", at(60), at(40), true},
+		{"c", at(60), time.Time{}, false},
+	}
+	for _, test := range tests {
+		last, found, err := h.LastTransition(test.componentId, test.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != test.found || !last.Time.Equal(test.last) || found && last.ComponentId != test.componentId {
+			t.Errorf("%s before %v: expected %v %v, got %v %v", test.componentId, test.t, test.last, test.found, last.Time, found)
+		}
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	h, cleanup := newTestHistory(t, Options{})
+	defer cleanup()
+
+	h.record(at(0), &api.Health{Status: api.StatusHealthy, Checks: api.Checks{
+		"a": {{Status: api.StatusHealthy}},
+	}})
+	h.record(at(1), &api.Health{Status: api.StatusUnhealthy, Checks: api.Checks{
+		"a": {{Status: api.StatusHealthy}, {Status: api.StatusWarn}},
+		"b": {{Status: api.StatusUnhealthy}},
+	}})
+	h.record(at(2), &api.Health{Status: api.StatusUnhealthy, Checks: api.Checks{
+		"b": {{Status: api.StatusUnhealthy}},
+	}})
+	h.record(at(3), &api.Health{Status: api.StatusHealthy, Checks: api.Checks{
+		"a": {{Status: api.StatusHealthy}},
+		"b": {{Status: api.StatusHealthy}},
+	}})
+
+	tests := []struct {
+		name        string
+		componentId string
+		since       time.Time
+		until       time.Time
+		times       []time.Time
+		statuses    []api.Status
+	}{
+		{"all", "", at(0), at(3), []time.Time{at(0), at(1), at(2), at(3)},
+			[]api.Status{api.StatusHealthy, api.StatusUnhealthy, api.StatusUnhealthy, api.StatusHealthy}},
+		{"time range is inclusive", "", at(1), at(2), []time.Time{at(1), at(2)},
+			[]api.Status{api.StatusUnhealthy, api.StatusUnhealthy}},
+		{"between snapshots", "", at(1).Add(time.Second), at(2).Add(-time.Second), nil, nil},
+		{"component", "a", at(0), at(3), []time.Time{at(0), at(1), at(3)},
+			[]api.Status{api.StatusHealthy, api.StatusWarn, api.StatusHealthy}},
+		{"component in time range", "b", at(2), at(10), []time.Time{at(2), at(3)},
+			[]api.Status{api.StatusUnhealthy, api.StatusHealthy}},
+		{"unknown component", "c", at(0), at(3), nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshots, err := h.Snapshots(test.componentId, test.since, test.until)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snapshots) != len(test.times) {
+				t.Fatalf("expected %d snapshots, got %+v", len(test.times), snapshots)
+			}
+			for i, snapshot := range snapshots {
+				if !snapshot.Time.Equal(test.times[i]) || snapshot.Health.Status != test.statuses[i] {
+					t.Errorf("expected %v at %v, got %v at %v", test.statuses[i], test.times[i], snapshot.Health.Status, snapshot.Time)
+				}
+				if test.componentId != "" {
+					if _, ok := snapshot.Health.Checks[test.componentId]; !ok || len(snapshot.Health.Checks) != 1 {
+						t.Errorf("expected only the checks of %s, got %v", test.componentId, snapshot.Health.Checks)
+					}
+				}
+			}
+		})
+	}
+}
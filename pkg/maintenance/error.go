@@ -0,0 +1,29 @@
+package maintenance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+)
+
+// maintenanceError annotates the error of a result that was downgraded
+// because of a maintenance window.
+type maintenanceError struct {
+	window string
+	until  time.Time
+	status api.Status
+	err    error
+}
+
+func (e *maintenanceError) Error() string {
+	msg := fmt.Sprintf("in maintenance window %s until %s, status was %s", e.window, api.FormatTime(e.until), e.status)
+	if e.err != nil {
+		msg += ": " + e.err.Error()
+	}
+	return msg
+}
+
+func (e *maintenanceError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,99 @@
+package maintenance
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxWindowSize is the maximum size of the request body of a window.
+const maxWindowSize = 64 << 10
+
+// Handler returns the HTTP API of the maintenance windows served under prefix:
+//
+//	GET    {prefix}       lists all windows
+//	POST   {prefix}       adds the window in the JSON request body
+//	DELETE {prefix}/{id}  removes a window
+//
+// Adding and removing windows requires the token of the options as bearer
+// token, and is forbidden if there is no token.
+func (m *Maintenance) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+		if r.Method == http.MethodPost || r.Method == http.MethodDelete {
+			if m.token == "" {
+				http.Error(w, "maintenance windows can only be changed when a maintenance token is configured", http.StatusForbidden)
+				return
+			}
+			if !m.authorized(r) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="maintenance"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		switch {
+		case id == "" && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, m.List())
+		case id == "" && r.Method == http.MethodPost:
+			var window Window
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWindowSize))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&window); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			window, err := m.Add(window)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("added maintenance window %s", window.Id)
+			writeJSON(w, http.StatusCreated, window)
+		case id != "" && r.Method == http.MethodDelete:
+			err := m.Remove(id)
+			switch {
+			case errors.Is(err, ErrNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, ErrReadOnly):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			default:
+				log.Printf("removed maintenance window %s", id)
+				w.WriteHeader(http.StatusNoContent)
+			}
+		case id == "":
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		default:
+			w.Header().Set("Allow", "DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// authorized returns true if the request has the token as bearer token.
+func (m *Maintenance) authorized(r *http.Request) bool {
+	const scheme = "Bearer "
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) < len(scheme) || !strings.EqualFold(authorization[:len(scheme)], scheme) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(authorization[len(scheme):]), []byte(m.token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,92 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func request(handler http.Handler, method string, target string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+const upgrade = `{"id":"upgrade","start":"2021-03-01T08:00:00Z","end":"2021-03-01T10:00:00Z"}`
+
+func TestHandlerIsReadOnlyWithoutToken(t *testing.T) {
+	m, err := New(Options{Windows: []Window{{Id: "backup", Cron: "0 3 * * *", Duration: "1h"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := m.Handler("/maintenance/")
+
+	rec := request(handler, http.MethodGet, "/maintenance", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var windows []Window
+	if err := json.Unmarshal(rec.Body.Bytes(), &windows); err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 1 || windows[0].Id != "backup" {
+		t.Errorf("unexpected windows: %+v", windows)
+	}
+
+	if rec := request(handler, http.MethodPost, "/maintenance", upgrade, "secret"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected POST to be forbidden, got %d", rec.Code)
+	}
+	if rec := request(handler, http.MethodDelete, "/maintenance/backup", "", "secret"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected DELETE to be forbidden, got %d", rec.Code)
+	}
+	if len(m.List()) != 1 {
+		t.Errorf("expected windows to be unchanged")
+	}
+}
+
+func TestHandlerWithToken(t *testing.T) {
+	m, err := New(Options{Token: "secret", Windows: []Window{{Id: "backup", Cron: "0 3 * * *", Duration: "1h"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := m.Handler("/maintenance")
+
+	for _, token := range []string{"", "wrong"} {
+		rec := request(handler, http.MethodPost, "/maintenance", upgrade, token)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("expected POST with token %q to be unauthorized, got %d", token, rec.Code)
+		}
+		if rec := request(handler, http.MethodDelete, "/maintenance/backup", "", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected DELETE with token %q to be unauthorized, got %d", token, rec.Code)
+		}
+	}
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/maintenance", upgrade, http.StatusCreated},
+		{http.MethodPost, "/maintenance", upgrade, http.StatusBadRequest},
+		{http.MethodPost, "/maintenance", `{"unknown":true}`, http.StatusBadRequest},
+		// the request body is limited
+		{http.MethodPost, "/maintenance", `{"id":"large","description":"` + strings.Repeat("x", maxWindowSize) + `"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/maintenance/backup", "", http.StatusConflict},
+		{http.MethodDelete, "/maintenance/upgrade", "", http.StatusNoContent},
+		{http.MethodDelete, "/maintenance/upgrade", "", http.StatusNotFound},
+		{http.MethodDelete, "/maintenance", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/maintenance/backup", "", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		if rec := request(handler, test.method, test.target, test.body, "secret"); rec.Code != test.status {
+			t.Errorf("%s %s %s: expected status %d, got %d: %s", test.method, test.target, test.body, test.status, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,421 @@
+// Package maintenance downgrades failing check results during maintenance windows.
+package maintenance
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrNotFound = errors.New("maintenance window not found")
+	ErrReadOnly = errors.New("maintenance window is configured in the configuration file")
+)
+
+// Window is a period of time during which failing results of the matching
+// components are downgraded.
+//
+// A one-off window lasts from Start to End. A recurring window starts at every
+// activation of the cron expression Cron and lasts for Duration. Start and End
+// of a recurring window are optional and limit the period it recurs in.
+type Window struct {
+	Id          string `json:"id" mapstructure:"id"`
+	Description string `json:"description,omitempty" mapstructure:"description"`
+	// Start and End are RFC 3339 timestamps.
+	Start    string `json:"start,omitempty" mapstructure:"start"`
+	End      string `json:"end,omitempty" mapstructure:"end"`
+	Cron     string `json:"cron,omitempty" mapstructure:"cron"`
+	Duration string `json:"duration,omitempty" mapstructure:"duration"`
+	// Components are the component ids the window applies to. Ids may contain
+	// wildcards like "veidemann:*". Ids without a target apply to the component
+	// of every target. If empty the window applies to all components.
+	Components []string `json:"components,omitempty" mapstructure:"components"`
+	// Active is true if the window is in effect.
+	Active bool `json:"active" mapstructure:"-"`
+	// ReadOnly is true if the window is configured in the configuration file.
+	ReadOnly bool `json:"readOnly" mapstructure:"-"`
+}
+
+// window is a parsed Window.
+type window struct {
+	Window
+	start    time.Time
+	end      time.Time
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+func parseWindow(w Window) (*window, error) {
+	parsed := &window{Window: w}
+	var err error
+	if w.Start != "" {
+		if parsed.start, err = time.Parse(time.RFC3339, w.Start); err != nil {
+			return nil, fmt.Errorf("invalid start of maintenance window %s: %w", w.Id, err)
+		}
+	}
+	if w.End != "" {
+		if parsed.end, err = time.Parse(time.RFC3339, w.End); err != nil {
+			return nil, fmt.Errorf("invalid end of maintenance window %s: %w", w.Id, err)
+		}
+		if parsed.end.Before(parsed.start) {
+			return nil, fmt.Errorf("maintenance window %s ends before it starts", w.Id)
+		}
+	}
+	for _, component := range w.Components {
+		if _, err := path.Match(component, ""); err != nil {
+			return nil, fmt.Errorf("invalid component of maintenance window %s: %q", w.Id, component)
+		}
+	}
+	if w.Cron == "" {
+		if w.Start == "" || w.End == "" {
+			return nil, fmt.Errorf("maintenance window %s must have either start and end or cron and duration", w.Id)
+		}
+		return parsed, nil
+	}
+	if parsed.schedule, err = cron.ParseStandard(w.Cron); err != nil {
+		return nil, fmt.Errorf("invalid cron expression of maintenance window %s: %w", w.Id, err)
+	}
+	if parsed.duration, err = time.ParseDuration(w.Duration); err != nil || parsed.duration <= 0 {
+		return nil, fmt.Errorf("invalid duration of maintenance window %s: %q", w.Id, w.Duration)
+	}
+	return parsed, nil
+}
+
+// activeUntil returns the end of the current period of the window, and false
+// if the window is not active at now.
+func (w *window) activeUntil(now time.Time) (time.Time, bool) {
+	if !w.start.IsZero() && now.Before(w.start) {
+		return time.Time{}, false
+	}
+	if !w.end.IsZero() && !now.Before(w.end) {
+		return time.Time{}, false
+	}
+	if w.schedule == nil {
+		return w.end, true
+	}
+	// the first activation after now - duration is the only one that can
+	// have started a period that includes now
+	activation := w.schedule.Next(now.Add(-w.duration))
+	if activation.IsZero() || activation.After(now) || activation.Before(w.start) {
+		return time.Time{}, false
+	}
+	return activation.Add(w.duration), true
+}
+
+// expired returns true if the window will never be active after now.
+func (w *window) expired(now time.Time) bool {
+	return !w.end.IsZero() && !now.Before(w.end)
+}
+
+// matches reports whether the window applies to the component. A pattern
+// without a target, like "veidemann:*", applies to the component of every target.
+func (w *window) matches(componentId string) bool {
+	if len(w.Components) == 0 {
+		return true
+	}
+	untargeted := componentId
+	if i := strings.Index(componentId, healthcheck.TargetSeparator); i >= 0 {
+		untargeted = componentId[i+1:]
+	}
+	for _, pattern := range w.Components {
+		if ok, _ := path.Match(pattern, componentId); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, untargeted); ok && !strings.Contains(pattern, healthcheck.TargetSeparator) {
+			return true
+		}
+	}
+	return false
+}
+
+type Options struct {
+	// File is the file windows created with the API are persisted to.
+	// If empty windows created with the API are lost on restart.
+	File string
+	// Windows are the windows from the configuration file. They can't be removed with the API.
+	Windows []Window
+	// Token is the bearer token required to add and remove windows with the API.
+	// If empty the API is read-only.
+	Token string
+}
+
+// Maintenance keeps the maintenance windows.
+type Maintenance struct {
+	file  string
+	token string
+	// now returns the current time. It is replaced by a fake clock in tests.
+	now func() time.Time
+
+	mu         sync.RWMutex
+	configured []*window
+	windows    []*window
+}
+
+// New creates a new Maintenance with the configured windows and the windows
+// persisted in the options file.
+func New(options Options) (*Maintenance, error) {
+	m := &Maintenance{
+		file:  options.File,
+		token: options.Token,
+		now:   time.Now,
+	}
+	configured, err := parseConfigured(options.Windows)
+	if err != nil {
+		return nil, err
+	}
+	m.configured = configured
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseConfigured parses the windows from the configuration file.
+func parseConfigured(windows []Window) ([]*window, error) {
+	var configured []*window
+	ids := make(map[string]bool)
+	for _, w := range windows {
+		if w.Id == "" {
+			return nil, fmt.Errorf("maintenance window is missing id")
+		}
+		if ids[w.Id] {
+			return nil, fmt.Errorf("duplicate maintenance window: %s", w.Id)
+		}
+		ids[w.Id] = true
+		w.ReadOnly = true
+		parsed, err := parseWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		configured = append(configured, parsed)
+	}
+	return configured, nil
+}
+
+// Configure replaces the windows from the configuration file, e.g. when the
+// configuration is reloaded. The windows created with the API are kept. If a
+// window is invalid or has the id of a window created with the API, the
+// current windows are kept.
+func (m *Maintenance) Configure(windows []Window) error {
+	configured, err := parseConfigured(windows)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, w := range configured {
+		for _, existing := range m.windows {
+			if existing.Id == w.Id {
+				return fmt.Errorf("duplicate maintenance window: %s", w.Id)
+			}
+		}
+	}
+	m.configured = configured
+	return nil
+}
+
+// load reads the persisted windows.
+func (m *Maintenance) load() error {
+	if m.file == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(m.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read maintenance windows: %w", err)
+	}
+	var windows []Window
+	if err := json.Unmarshal(data, &windows); err != nil {
+		return fmt.Errorf("failed to read maintenance windows from %s: %w", m.file, err)
+	}
+	for _, w := range windows {
+		w.ReadOnly = false
+		parsed, err := parseWindow(w)
+		if err != nil {
+			return err
+		}
+		m.windows = append(m.windows, parsed)
+	}
+	return nil
+}
+
+// save persists the windows created with the API. The caller must hold the lock.
+func (m *Maintenance) save() error {
+	if m.file == "" {
+		return nil
+	}
+	windows := make([]Window, 0, len(m.windows))
+	for _, w := range m.windows {
+		windows = append(windows, w.Window)
+	}
+	data, err := json.MarshalIndent(windows, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash can't leave a truncated file
+	tmp, err := ioutil.TempFile(filepath.Dir(m.file), filepath.Base(m.file)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save maintenance windows: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to save maintenance windows: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save maintenance windows: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), m.file); err != nil {
+		return fmt.Errorf("failed to save maintenance windows: %w", err)
+	}
+	return nil
+}
+
+// List returns all windows sorted by id.
+func (m *Maintenance) List() []Window {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := m.now()
+	windows := make([]Window, 0, len(m.configured)+len(m.windows))
+	for _, w := range append(m.configured[:len(m.configured):len(m.configured)], m.windows...) {
+		window := w.Window
+		_, window.Active = w.activeUntil(now)
+		windows = append(windows, window)
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].Id < windows[j].Id
+	})
+	return windows
+}
+
+// Add adds a window and persists it. A window without id is given a random id.
+// One-off windows that have ended are removed.
+func (m *Maintenance) Add(w Window) (Window, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if w.Id == "" {
+		w.Id = newId()
+	}
+	for _, existing := range append(m.configured[:len(m.configured):len(m.configured)], m.windows...) {
+		if existing.Id == w.Id {
+			return Window{}, fmt.Errorf("duplicate maintenance window: %s", w.Id)
+		}
+	}
+	w.ReadOnly = false
+	w.Active = false
+	parsed, err := parseWindow(w)
+	if err != nil {
+		return Window{}, err
+	}
+
+	now := m.now()
+	var windows []*window
+	for _, existing := range m.windows {
+		if !existing.expired(now) {
+			windows = append(windows, existing)
+		}
+	}
+	previous := m.windows
+	m.windows = append(windows, parsed)
+	if err := m.save(); err != nil {
+		m.windows = previous
+		return Window{}, err
+	}
+
+	_, parsed.Window.Active = parsed.activeUntil(now)
+	return parsed.Window, nil
+}
+
+// Remove removes the window with the given id.
+func (m *Maintenance) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, w := range m.configured {
+		if w.Id == id {
+			return ErrReadOnly
+		}
+	}
+	for i, w := range m.windows {
+		if w.Id == id {
+			previous := m.windows
+			m.windows = append(m.windows[:i:i], m.windows[i+1:]...)
+			if err := m.save(); err != nil {
+				m.windows = previous
+				return err
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Apply returns checkResult with the failing results downgraded to pass if
+// the component is in an active maintenance window. The output of downgraded
+// results tells the window and the original status. checkResult is not modified.
+func (m *Maintenance) Apply(checkResult *healthcheck.CheckResult) *healthcheck.CheckResult {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := m.now()
+	var active *window
+	var until time.Time
+	for _, w := range append(m.configured[:len(m.configured):len(m.configured)], m.windows...) {
+		if !w.matches(checkResult.Name) {
+			continue
+		}
+		if end, ok := w.activeUntil(now); ok {
+			active, until = w, end
+			break
+		}
+	}
+	if active == nil {
+		return checkResult
+	}
+
+	downgraded := *checkResult
+	downgraded.Results = make([]*healthcheck.Result, len(checkResult.Results))
+	for i, result := range checkResult.Results {
+		if result.Status != healthcheck.StatusWarning && result.Status != healthcheck.StatusFail {
+			downgraded.Results[i] = result
+			continue
+		}
+		r := *result
+		r.Status = healthcheck.StatusPass
+		r.Err = &maintenanceError{
+			window: active.Id,
+			until:  until,
+			status: healthcheck.ToApiStatus(result.Status),
+			err:    result.Err,
+		}
+		downgraded.Results[i] = &r
+	}
+	return &downgraded
+}
+
+func newId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,307 @@
+package maintenance
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+)
+
+func TestActiveUntil(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2021, 3, day, hour, min, 0, 0, time.UTC)
+	}
+	oneOff := Window{Id: "upgrade", Start: "2021-03-01T08:00:00Z", End: "2021-03-01T10:00:00Z"}
+	recurring := Window{Id: "backup", Cron: "0 3 * * *", Duration: "1h"}
+	limited := Window{Id: "backup", Cron: "0 3 * * *", Duration: "1h", Start: "2021-03-02T03:30:00Z", End: "2021-03-04T03:30:00Z"}
+
+	tests := []struct {
+		name   string
+		window Window
+		now    time.Time
+		until  time.Time
+		active bool
+	}{
+		{"before one-off", oneOff, at(1, 7, 59), time.Time{}, false},
+		{"start of one-off", oneOff, at(1, 8, 0), at(1, 10, 0), true},
+		{"during one-off", oneOff, at(1, 9, 59), at(1, 10, 0), true},
+		{"end of one-off", oneOff, at(1, 10, 0), time.Time{}, false},
+		{"before recurring", recurring, at(1, 2, 59), time.Time{}, false},
+		{"start of recurring", recurring, at(1, 3, 0), at(1, 4, 0), true},
+		{"during recurring", recurring, at(2, 3, 59), at(2, 4, 0), true},
+		{"end of recurring", recurring, at(2, 4, 0), time.Time{}, false},
+		{"before limit", limited, at(1, 3, 30), time.Time{}, false},
+		{"period started before limit", limited, at(2, 3, 45), time.Time{}, false},
+		{"within limits", limited, at(3, 3, 30), at(3, 4, 0), true},
+		{"after limit", limited, at(4, 3, 30), time.Time{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w, err := parseWindow(test.window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			until, active := w.activeUntil(test.now)
+			if active != test.active || !until.Equal(test.until) {
+				t.Errorf("expected %v %v, got %v %v", test.until, test.active, until, active)
+			}
+		})
+	}
+}
+
+func TestParseWindowErrors(t *testing.T) {
+	for _, w := range []Window{
+		{Id: "missing end", Start: "2021-03-01T08:00:00Z"},
+		{Id: "invalid start", Start: "08:00", End: "2021-03-01T10:00:00Z"},
+		{Id: "ends before start", Start: "2021-03-01T10:00:00Z", End: "2021-03-01T08:00:00Z"},
+		{Id: "invalid cron", Cron: "0 25 * * *", Duration: "1h"},
+		{Id: "missing duration", Cron: "0 3 * * *"},
+		{Id: "negative duration", Cron: "0 3 * * *", Duration: "-1h"},
+		{Id: "invalid component", Start: "2021-03-01T08:00:00Z", End: "2021-03-01T10:00:00Z", Components: []string{"["}},
+	} {
+		if _, err := parseWindow(w); err == nil {
+			t.Errorf("%s: expected error", w.Id)
+		}
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	options := Options{
+		File:    filepath.Join(dir, "maintenance.json"),
+		Windows: []Window{{Id: "backup", Cron: "0 3 * * *", Duration: "1h"}},
+	}
+	m, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return now }
+
+	upgrade, err := m.Add(Window{Description: "upgrade", Start: "2021-03-01T08:00:00Z", End: "2021-03-01T10:00:00Z", Components: []string{"veidemann:*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upgrade.Id == "" || !upgrade.Active || upgrade.ReadOnly {
+		t.Errorf("unexpected window: %+v", upgrade)
+	}
+	if _, err := m.Add(Window{Id: "old", Start: "2021-02-01T08:00:00Z", End: "2021-02-01T10:00:00Z"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Add(Window{Id: "nightly", Cron: "0 1 * * *", Duration: "30m"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Add(Window{Id: "backup", Cron: "0 1 * * *", Duration: "30m"}); err == nil {
+		t.Error("expected error for duplicate window")
+	}
+	if err := m.Remove("nightly"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Remove("backup"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected %v, got %v", ErrReadOnly, err)
+	}
+	if err := m.Remove("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	// the windows created with the API are read back, except the one that was
+	// removed and the one-off window that had ended when a window was added
+	m, err = New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return now }
+	windows := m.List()
+	if len(windows) != 2 {
+		t.Fatalf("expected 2 windows, got %+v", windows)
+	}
+	backup, restored := windows[0], windows[1]
+	if restored.Id == "backup" {
+		backup, restored = restored, backup
+	}
+	if backup.Id != "backup" || !backup.ReadOnly || backup.Active {
+		t.Errorf("unexpected configured window: %+v", backup)
+	}
+	if restored.Id != upgrade.Id || restored.Description != "upgrade" || restored.ReadOnly || !restored.Active ||
+		len(restored.Components) != 1 || restored.Components[0] != "veidemann:*" {
+		t.Errorf("unexpected restored window: %+v", restored)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := ioutil.WriteFile(corrupt, []byte("["), 0644); err != nil {
+		t.Fatal(err)
+	}
+	window := Window{Id: "backup", Cron: "0 3 * * *", Duration: "1h"}
+	for name, options := range map[string]Options{
+		"missing id":     {Windows: []Window{{Cron: "0 3 * * *", Duration: "1h"}}},
+		"duplicate id":   {Windows: []Window{window, window}},
+		"corrupt file":   {File: corrupt},
+		"invalid window": {Windows: []Window{{Id: "backup", Cron: "0 3 * * *"}}},
+	} {
+		if _, err := New(options); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	m, err := New(Options{Windows: []Window{{Id: "backup", Cron: "0 3 * * *", Duration: "1h"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Add(Window{Id: "upgrade", Start: "2021-03-01T08:00:00Z", End: "2021-03-01T10:00:00Z"}); err != nil {
+		t.Fatal(err)
+	}
+	ids := func() []string {
+		var ids []string
+		for _, w := range m.List() {
+			ids = append(ids, w.Id)
+		}
+		return ids
+	}
+
+	// the configured windows are replaced and the windows created with the API are kept
+	if err := m.Configure([]Window{{Id: "restart", Cron: "0 4 * * *", Duration: "30m"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(), []string{"restart", "upgrade"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected windows %v, got %v", want, got)
+	}
+	if err := m.Remove("restart"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected configured window to be read-only, got %v", err)
+	}
+
+	// invalid windows are rejected and the current windows are kept
+	for name, windows := range map[string][]Window{
+		"missing id":              {{Cron: "0 3 * * *", Duration: "1h"}},
+		"invalid window":          {{Id: "backup", Cron: "0 3 * * *"}},
+		"id of window of the API": {{Id: "upgrade", Cron: "0 3 * * *", Duration: "1h"}},
+	} {
+		if err := m.Configure(windows); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if got, want := ids(), []string{"restart", "upgrade"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected windows %v, got %v", want, got)
+	}
+
+	if err := m.Configure(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(), []string{"upgrade"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected windows %v, got %v", want, got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	m, err := New(Options{Windows: []Window{
+		{Id: "upgrade", Start: "2021-03-01T08:00:00Z", End: "2021-03-01T10:00:00Z", Components: []string{"veidemann:dash*", "newscrawl/*"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	cause := errors.New("connection refused")
+	checkResult := &healthcheck.CheckResult{
+		Name: healthcheck.VeidemannDashboard,
+		Results: []*healthcheck.Result{
+			{Id: "a", Status: healthcheck.StatusFail, Err: cause},
+			{Id: "b", Status: healthcheck.StatusWarning},
+			{Id: "c", Status: healthcheck.StatusPass},
+		},
+	}
+
+	applied := m.Apply(checkResult)
+	if applied == checkResult {
+		t.Fatal("expected a new check result")
+	}
+	for i, result := range applied.Results {
+		if result.Status != healthcheck.StatusPass {
+			t.Errorf("expected result %d to pass, got %v", i, result.Status)
+		}
+	}
+	if got, want := applied.Results[0].Err.Error(), "in maintenance window upgrade until 2021-03-01T10:00:00Z, status was down: connection refused"; got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+	if !errors.Is(applied.Results[0].Err, cause) {
+		t.Errorf("expected the original error to be wrapped")
+	}
+	if got, want := applied.Results[1].Err.Error(), "in maintenance window upgrade until 2021-03-01T10:00:00Z, status was warn"; got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+	if applied.Results[2] != checkResult.Results[2] {
+		t.Errorf("expected passing result to be unchanged")
+	}
+	if checkResult.Results[0].Status != healthcheck.StatusFail || checkResult.Results[0].Err != cause {
+		t.Errorf("expected check result not to be modified")
+	}
+
+	target := &healthcheck.CheckResult{Name: "newscrawl/" + healthcheck.VeidemannHarvest, Results: []*healthcheck.Result{{Status: healthcheck.StatusFail}}}
+	if applied := m.Apply(target); applied.Results[0].Status != healthcheck.StatusPass {
+		t.Errorf("expected component of target to be in maintenance")
+	}
+
+	other := &healthcheck.CheckResult{Name: healthcheck.VeidemannHarvest, Results: []*healthcheck.Result{{Status: healthcheck.StatusFail}}}
+	if applied := m.Apply(other); applied != other {
+		t.Errorf("expected component without maintenance window to be unchanged")
+	}
+
+	now = time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	if applied := m.Apply(checkResult); applied != checkResult {
+		t.Errorf("expected check result after the window to be unchanged")
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		components  []string
+		componentId string
+		matches     bool
+	}{
+		{nil, "veidemann:harvest", true},
+		{nil, "newscrawl/veidemann:harvest", true},
+		{[]string{"veidemann:harvest"}, "veidemann:harvest", true},
+		{[]string{"veidemann:harvest"}, "veidemann:dashboard", false},
+		{[]string{"veidemann:*"}, "veidemann:harvest", true},
+		{[]string{"veidemann:*"}, "prometheus:queue", false},
+		// a pattern without target matches the component of every target
+		{[]string{"veidemann:*"}, "newscrawl/veidemann:harvest", true},
+		{[]string{"veidemann:harvest"}, "newscrawl/veidemann:harvest", true},
+		{[]string{"*"}, "newscrawl/veidemann:harvest", true},
+		{[]string{"newscrawl/*"}, "newscrawl/veidemann:harvest", true},
+		{[]string{"newscrawl/*"}, "webarchive/veidemann:harvest", false},
+		{[]string{"newscrawl/*"}, "veidemann:harvest", false},
+		{[]string{"*/veidemann:harvest"}, "webarchive/veidemann:harvest", true},
+		{[]string{"webarchive/veidemann:*"}, "newscrawl/veidemann:harvest", false},
+		{[]string{"veidemann:dashboard", "newscrawl/*"}, "newscrawl/prometheus:queue", true},
+	}
+	for _, test := range tests {
+		w, err := parseWindow(Window{Id: "w", Cron: "0 3 * * *", Duration: "1h", Components: test.components})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := w.matches(test.componentId); got != test.matches {
+			t.Errorf("%v matching %s: expected %v, got %v", test.components, test.componentId, test.matches, got)
+		}
+	}
+}
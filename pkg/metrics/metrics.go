@@ -0,0 +1,167 @@
+// Package metrics exports check results as Prometheus metrics.
+package metrics
+
+import (
+	"strings"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "veidemann_health_check"
+
+var labels = []string{"component", "component_id", "type"}
+
+var statuses = []api.Status{api.StatusHealthy, api.StatusWarn, api.StatusUnhealthy}
+
+// Exporter exports check results as Prometheus metrics.
+type Exporter struct {
+	status   *prometheus.GaugeVec
+	value    *prometheus.GaugeVec
+	field    *prometheus.GaugeVec
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+
+	// series of the last results of every component
+	series map[string]map[string]series
+}
+
+// series identifies the metrics of one result.
+type series struct {
+	labelValues []string
+	// unit of the observed value, or nil if there is no numeric value
+	unit *string
+	// numeric fields of the observed value if it is a struct
+	fields []string
+}
+
+// delete deletes the metrics of the series from e.
+func (s series) delete(e *Exporter) {
+	for _, status := range statuses {
+		e.status.DeleteLabelValues(append(s.labelValues, string(status))...)
+	}
+	s.deleteValue(e)
+	s.deleteFields(e, nil)
+	e.duration.DeleteLabelValues(s.labelValues...)
+	e.errors.DeleteLabelValues(s.labelValues...)
+}
+
+func (s series) deleteValue(e *Exporter) {
+	if s.unit != nil {
+		e.value.DeleteLabelValues(append(s.labelValues, *s.unit)...)
+	}
+}
+
+// deleteFields deletes the field metrics of the series from e that are not in keep.
+func (s series) deleteFields(e *Exporter, keep map[string]float64) {
+	for _, field := range s.fields {
+		if _, ok := keep[field]; !ok {
+			e.field.DeleteLabelValues(append(s.labelValues, field)...)
+		}
+	}
+}
+
+// New creates a new exporter and registers its metrics with registerer.
+func New(registerer prometheus.Registerer) (*Exporter, error) {
+	e := &Exporter{
+		status: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "status",
+			Help:      "Status of check, 1 for the current status and 0 for the others.",
+		}, append(labels, "status")),
+		value: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "observed_value",
+			Help:      "Numeric observed value of check.",
+		}, append(labels, "unit")),
+		field: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "observed_field",
+			Help:      "Numeric field of observed value of check, e.g. the progress counters of a job execution.",
+		}, append(labels, "field")),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "duration_seconds",
+			Help:      "Duration of check.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2, 5},
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Number of checks that failed with an error.",
+		}, labels),
+		series: make(map[string]map[string]series),
+	}
+	for _, collector := range []prometheus.Collector{e.status, e.value, e.field, e.duration, e.errors} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Remove deletes the metrics of a component that is no longer checked.
+// Calls to Remove must be serialized with calls to Observe.
+func (e *Exporter) Remove(componentId string) {
+	for _, s := range e.series[componentId] {
+		s.delete(e)
+	}
+	delete(e.series, componentId)
+}
+
+// Observe updates the metrics with the results of a component. Metrics of
+// earlier results that are not in the new results, e.g. of job executions that
+// have finished, are deleted. Calls to Observe must be serialized.
+func (e *Exporter) Observe(checkResult *healthcheck.CheckResult) {
+	previous := e.series[checkResult.Name]
+	current := make(map[string]series, len(checkResult.Results))
+	defer func() {
+		for key, s := range previous {
+			if _, ok := current[key]; !ok {
+				s.delete(e)
+			}
+		}
+		e.series[checkResult.Name] = current
+	}()
+
+	for _, result := range checkResult.Results {
+		labelValues := []string{checkResult.Name, result.Id, result.Type}
+		key := strings.Join(labelValues, "\x00")
+		s := series{labelValues: labelValues}
+
+		status := healthcheck.ToApiStatus(result.Status)
+		for _, s := range statuses {
+			gauge := e.status.WithLabelValues(append(labelValues, string(s))...)
+			if s == status {
+				gauge.Set(1)
+			} else {
+				gauge.Set(0)
+			}
+		}
+
+		if value, ok := healthcheck.NumericValue(result.Value); ok {
+			unit := result.Unit
+			s.unit = &unit
+			e.value.WithLabelValues(append(labelValues, result.Unit)...).Set(value)
+		}
+		fields, _ := healthcheck.NumericFields(result.Value)
+		for field, value := range fields {
+			s.fields = append(s.fields, field)
+			e.field.WithLabelValues(append(labelValues, field)...).Set(value)
+		}
+		if p, ok := previous[key]; ok {
+			if p.unit != nil && (s.unit == nil || *p.unit != *s.unit) {
+				p.deleteValue(e)
+			}
+			p.deleteFields(e, fields)
+		}
+		current[key] = s
+
+		e.duration.WithLabelValues(labelValues...).Observe(result.Duration.Seconds())
+
+		if result.Err != nil {
+			e.errors.WithLabelValues(labelValues...).Inc()
+		}
+	}
+}
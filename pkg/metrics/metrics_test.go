@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// seriesOf returns the number of series of every metric in registry with the given component id.
+func seriesOf(t *testing.T, registry *prometheus.Registry, componentId string) map[string]int {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[string]int)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "component_id" && label.GetValue() == componentId {
+					count[family.GetName()]++
+				}
+			}
+		}
+	}
+	return count
+}
+
+func TestObserveDeletesSeriesOfRemovedResults(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	e, err := New(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.Observe(&healthcheck.CheckResult{
+		Name: healthcheck.VeidemannJobProgress,
+		Results: []*healthcheck.Result{
+			{Id: "jes-1", Status: healthcheck.StatusPass, Value: 1.0},
+			{Id: "jes-2", Status: healthcheck.StatusWarning, Value: 2.0, Err: errors.New("stalled")},
+		},
+	})
+	want := map[string]int{
+		"veidemann_health_check_status":           3,
+		"veidemann_health_check_observed_value":   1,
+		"veidemann_health_check_duration_seconds": 1,
+		"veidemann_health_check_errors_total":     1,
+	}
+	for name, n := range want {
+		if got := seriesOf(t, registry, "jes-2")[name]; got != n {
+			t.Errorf("expected %d series of %s, got %d", n, name, got)
+		}
+	}
+
+	// jes-2 has finished and jes-1 no longer has a value
+	e.Observe(&healthcheck.CheckResult{
+		Name:    healthcheck.VeidemannJobProgress,
+		Results: []*healthcheck.Result{{Id: "jes-1", Status: healthcheck.StatusPass}},
+	})
+	if got := seriesOf(t, registry, "jes-2"); len(got) != 0 {
+		t.Errorf("expected series of jes-2 to be deleted, got %v", got)
+	}
+	got := seriesOf(t, registry, "jes-1")
+	if got["veidemann_health_check_observed_value"] != 0 {
+		t.Errorf("expected observed value of jes-1 to be deleted")
+	}
+	if got["veidemann_health_check_status"] != 3 {
+		t.Errorf("expected 3 status series of jes-1, got %d", got["veidemann_health_check_status"])
+	}
+}
+
+func TestObserveExportsNumericFields(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	e, err := New(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := healthcheck.JobProgress{
+		JobExecutionId:   "jes-1",
+		JobId:            "job-1",
+		DocumentsCrawled: 42,
+		BytesCrawled:     1024,
+		ExecutionsState:  map[string]int32{"FETCHING": 1},
+	}
+	e.Observe(&healthcheck.CheckResult{
+		Name:    healthcheck.VeidemannJobProgress,
+		Results: []*healthcheck.Result{{Id: "jes-1", Status: healthcheck.StatusPass, Value: progress}},
+	})
+	got := seriesOf(t, registry, "jes-1")
+	// one series per counter
+	if got["veidemann_health_check_observed_field"] != 7 {
+		t.Errorf("expected 7 field series, got %d", got["veidemann_health_check_observed_field"])
+	}
+	if got["veidemann_health_check_observed_value"] != 0 {
+		t.Errorf("expected no observed value series")
+	}
+	gauge, err := e.field.GetMetricWithLabelValues(healthcheck.VeidemannJobProgress, "jes-1", "", "documentsCrawled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := testutil.ToFloat64(gauge); value != 42 {
+		t.Errorf("expected 42 documents crawled, got %v", value)
+	}
+
+	e.Observe(&healthcheck.CheckResult{
+		Name:    healthcheck.VeidemannJobProgress,
+		Results: []*healthcheck.Result{{Id: "jes-1", Status: healthcheck.StatusPass, Value: 1.0}},
+	})
+	if got := seriesOf(t, registry, "jes-1")["veidemann_health_check_observed_field"]; got != 0 {
+		t.Errorf("expected field series to be deleted, got %d", got)
+	}
+}
@@ -0,0 +1,23 @@
+package slo
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Handler returns a handler that responds with the availability report.
+func (s *SLO) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := s.Report()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Println(err)
+		}
+	}
+}
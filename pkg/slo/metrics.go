@@ -0,0 +1,65 @@
+package slo
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "veidemann_health_check"
+
+var labels = []string{"component", "window"}
+
+var (
+	uptimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "slo", "uptime_ratio"),
+		"Share of the window the component was available.",
+		labels, nil)
+	incidentsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "slo", "incidents"),
+		"Number of times the component went down within the window.",
+		labels, nil)
+	mttrDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "slo", "mttr_seconds"),
+		"Mean time to recovery of the incidents that ended within the window.",
+		labels, nil)
+	burnRateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "slo", "burn_rate"),
+		"Rate the error budget is consumed at within the window.",
+		labels, nil)
+	targetDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "slo", "target_ratio"),
+		"Availability objective.",
+		nil, nil)
+)
+
+// Describe implements prometheus.Collector.
+func (s *SLO) Describe(ch chan<- *prometheus.Desc) {
+	ch <- uptimeDesc
+	ch <- incidentsDesc
+	ch <- mttrDesc
+	ch <- burnRateDesc
+	ch <- targetDesc
+}
+
+// Collect implements prometheus.Collector. The availability is computed when
+// the metrics are collected.
+func (s *SLO) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(targetDesc, prometheus.GaugeValue, s.options.Target/100)
+
+	report, err := s.Report()
+	if err != nil {
+		log.Printf("failed to compute availability: %v", err)
+		return
+	}
+	for componentId, availabilities := range report.Components {
+		for _, a := range availabilities {
+			ch <- prometheus.MustNewConstMetric(uptimeDesc, prometheus.GaugeValue, a.Uptime/100, componentId, a.Window)
+			ch <- prometheus.MustNewConstMetric(incidentsDesc, prometheus.GaugeValue, float64(a.Incidents), componentId, a.Window)
+			if a.MTTR != "" {
+				ch <- prometheus.MustNewConstMetric(mttrDesc, prometheus.GaugeValue, a.MTTRSeconds, componentId, a.Window)
+			}
+			ch <- prometheus.MustNewConstMetric(burnRateDesc, prometheus.GaugeValue, a.BurnRate, componentId, a.Window)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package slo computes the availability of components from the recorded status
+// transitions and tracks it against a service level objective.
+package slo
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/history"
+)
+
+type Options struct {
+	// Target is the availability objective in percent, e.g. 99.5.
+	Target float64
+	// Windows are the rolling windows availability is computed over.
+	Windows []time.Duration
+}
+
+// Availability is the availability of a component over a rolling window.
+// A component is available unless its status is down.
+type Availability struct {
+	Window string `json:"window"`
+	// Observed is how much of the window the status of the component is known for.
+	Observed string `json:"observed"`
+	// Uptime is the share of the observed time the component was available in percent.
+	Uptime float64 `json:"uptime"`
+	// Incidents is the number of times the component went down.
+	Incidents int `json:"incidents"`
+	// MTTR is the mean time to recovery of the incidents that ended within the window.
+	MTTR        string  `json:"mttr,omitempty"`
+	MTTRSeconds float64 `json:"mttrSeconds,omitempty"`
+	// BurnRate is the rate the error budget is consumed at. At a burn rate of 1
+	// the budget is used up at the end of the window.
+	BurnRate float64 `json:"burnRate"`
+}
+
+// Report is the availability of every component.
+type Report struct {
+	Target     float64                   `json:"target"`
+	Time       string                    `json:"time"`
+	Components map[string][]Availability `json:"components"`
+}
+
+// SLO computes availability from the history.
+type SLO struct {
+	options Options
+	history *history.History
+	// now returns the current time. It is replaced by a fake clock in tests.
+	now func() time.Time
+}
+
+// New creates a new SLO that computes availability from h.
+func New(h *history.History, options Options) (*SLO, error) {
+	if options.Target <= 0 || options.Target >= 100 {
+		return nil, fmt.Errorf("SLO target must be between 0 and 100: %v", options.Target)
+	}
+	if len(options.Windows) == 0 {
+		return nil, fmt.Errorf("missing SLO windows")
+	}
+	for _, window := range options.Windows {
+		if window <= 0 {
+			return nil, fmt.Errorf("SLO window must be positive: %v", window)
+		}
+	}
+	return &SLO{
+		options: options,
+		history: h,
+		now:     time.Now,
+	}, nil
+}
+
+// formatWindow formats a window in the largest whole unit of days, hours or
+// minutes, e.g. 7d, and other windows like time.Duration.
+func formatWindow(window time.Duration) string {
+	for _, unit := range []struct {
+		duration time.Duration
+		suffix   string
+	}{
+		{24 * time.Hour, "d"},
+		{time.Hour, "h"},
+		{time.Minute, "m"},
+	} {
+		if window >= unit.duration && window%unit.duration == 0 {
+			return strconv.Itoa(int(window/unit.duration)) + unit.suffix
+		}
+	}
+	return window.String()
+}
+
+// Report computes the availability of every component with recorded transitions.
+func (s *SLO) Report() (*Report, error) {
+	now := s.now()
+	componentIds, err := s.history.Components()
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Target:     s.options.Target,
+		Time:       api.FormatTime(now),
+		Components: make(map[string][]Availability),
+	}
+	for _, componentId := range componentIds {
+		for _, window := range s.options.Windows {
+			availability, ok, err := s.availability(componentId, window, now)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				report.Components[componentId] = append(report.Components[componentId], availability)
+			}
+		}
+	}
+	return report, nil
+}
+
+// availability computes the availability of a component over the window
+// ending at now, and false if the status of the component is unknown in the window.
+func (s *SLO) availability(componentId string, window time.Duration, now time.Time) (Availability, bool, error) {
+	start := now.Add(-window)
+	transitions, err := s.history.Transitions(componentId, start, now)
+	if err != nil {
+		return Availability{}, false, err
+	}
+	baseline, found, err := s.history.LastTransition(componentId, start)
+	if err != nil {
+		return Availability{}, false, err
+	}
+
+	var status api.Status
+	var t, downSince time.Time
+	if found {
+		status = baseline.Status
+		t = start
+		downSince = baseline.Time
+	}
+
+	var observed, down, repairTime time.Duration
+	repaired := 0
+	a := Availability{Window: formatWindow(window)}
+	accumulate := func(until time.Time) {
+		if status == "" {
+			return
+		}
+		observed += until.Sub(t)
+		if status == api.StatusUnhealthy {
+			down += until.Sub(t)
+		}
+	}
+	for _, transition := range transitions {
+		accumulate(transition.Time)
+		if transition.Status == api.StatusUnhealthy && status != api.StatusUnhealthy {
+			a.Incidents++
+			downSince = transition.Time
+		} else if status == api.StatusUnhealthy && transition.Status != api.StatusUnhealthy {
+			repaired++
+			repairTime += transition.Time.Sub(downSince)
+		}
+		status, t = transition.Status, transition.Time
+	}
+	accumulate(now)
+
+	if observed <= 0 {
+		return Availability{}, false, nil
+	}
+	a.Observed = observed.Round(time.Second).String()
+	a.Uptime = float64(observed-down) * 100 / float64(observed)
+	a.BurnRate = (100 - a.Uptime) / (100 - s.options.Target)
+	if repaired > 0 {
+		mttr := repairTime / time.Duration(repaired)
+		a.MTTR = mttr.Round(time.Second).String()
+		a.MTTRSeconds = mttr.Seconds()
+	}
+	return a, true, nil
+}
@@ -0,0 +1,173 @@
+package slo
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/history"
+)
+
+func newTestHistory(t *testing.T) (*history.History, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "slo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := history.New(history.Options{File: filepath.Join(dir, "history.db"), SnapshotInterval: time.Minute})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return h, func() {
+		_ = h.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// observe records the status of a component at time t.
+func observe(h *history.History, componentId string, status healthcheck.Status, t time.Time) {
+	h.Observe(&healthcheck.CheckResult{
+		Name:    componentId,
+		Results: []*healthcheck.Result{{Status: status}},
+		Time:    t,
+	})
+}
+
+func TestReport(t *testing.T) {
+	h, cleanup := newTestHistory(t)
+	defer cleanup()
+
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	observe(h, healthcheck.VeidemannDashboard, healthcheck.StatusPass, now.Add(-30*time.Hour))
+	observe(h, healthcheck.VeidemannDashboard, healthcheck.StatusFail, now.Add(-10*time.Hour))
+	observe(h, healthcheck.VeidemannDashboard, healthcheck.StatusPass, now.Add(-9*time.Hour))
+	observe(h, healthcheck.VeidemannDashboard, healthcheck.StatusFail, now.Add(-2*time.Hour))
+	// a warning counts as available
+	observe(h, healthcheck.VeidemannDashboard, healthcheck.StatusWarning, now.Add(-45*time.Minute))
+	observe(h, healthcheck.VeidemannDashboard, healthcheck.StatusFail, now.Add(-30*time.Minute))
+	observe(h, healthcheck.VeidemannHarvest, healthcheck.StatusPass, now.Add(-30*time.Minute))
+	// transitions after now are not counted
+	observe(h, healthcheck.VeidemannHarvest, healthcheck.StatusFail, now.Add(time.Minute))
+
+	s, err := New(h, Options{Target: 99, Windows: []time.Duration{24 * time.Hour, time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+
+	report, err := s.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Target != 99 || report.Time != "2021-03-01T12:00:00Z" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	// down 1h, 1h15m and 30m of 24h
+	uptime := 100 * (1 - (2*time.Hour+45*time.Minute).Hours()/24)
+	want := map[string][]Availability{
+		healthcheck.VeidemannDashboard: {
+			{
+				Window:      "1d",
+				Observed:    "24h0m0s",
+				Uptime:      uptime,
+				Incidents:   3,
+				MTTR:        "1h7m30s",
+				MTTRSeconds: (time.Hour + 7*time.Minute + 30*time.Second).Seconds(),
+				BurnRate:    (100 - uptime) / 1,
+			},
+			{
+				// down since before the window until 15m into it, and the last 30m
+				Window:      "1h",
+				Observed:    "1h0m0s",
+				Uptime:      25,
+				Incidents:   1,
+				MTTR:        "1h15m0s",
+				MTTRSeconds: (time.Hour + 15*time.Minute).Seconds(),
+				BurnRate:    75,
+			},
+		},
+		// only the observed time counts
+		healthcheck.VeidemannHarvest: {
+			{Window: "1d", Observed: "30m0s", Uptime: 100},
+			{Window: "1h", Observed: "30m0s", Uptime: 100},
+		},
+	}
+	if len(report.Components) != len(want) {
+		t.Errorf("expected %d components, got %d", len(want), len(report.Components))
+	}
+	for componentId, availabilities := range want {
+		got := report.Components[componentId]
+		if len(got) != len(availabilities) {
+			t.Errorf("%s: expected %d windows, got %d", componentId, len(availabilities), len(got))
+			continue
+		}
+		for i, a := range availabilities {
+			if !equal(got[i], a) {
+				t.Errorf("%s: expected %+v, got %+v", componentId, a, got[i])
+			}
+		}
+	}
+}
+
+func equal(a, b Availability) bool {
+	const epsilon = 1e-9
+	return a.Window == b.Window && a.Observed == b.Observed && a.Incidents == b.Incidents && a.MTTR == b.MTTR &&
+		math.Abs(a.Uptime-b.Uptime) < epsilon &&
+		math.Abs(a.MTTRSeconds-b.MTTRSeconds) < epsilon &&
+		math.Abs(a.BurnRate-b.BurnRate) < epsilon
+}
+
+func TestReportWithoutObservations(t *testing.T) {
+	h, cleanup := newTestHistory(t)
+	defer cleanup()
+
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	observe(h, healthcheck.VeidemannDashboard, healthcheck.StatusPass, now.Add(time.Hour))
+
+	s, err := New(h, Options{Target: 99, Windows: []time.Duration{time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+
+	report, err := s.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Components) != 0 {
+		t.Errorf("expected no components, got %+v", report.Components)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	for _, options := range []Options{
+		{Target: 0, Windows: []time.Duration{time.Hour}},
+		{Target: 100, Windows: []time.Duration{time.Hour}},
+		{Target: 99},
+		{Target: 99, Windows: []time.Duration{0}},
+	} {
+		if _, err := New(nil, options); err == nil {
+			t.Errorf("expected error for %+v", options)
+		}
+	}
+}
+
+func TestFormatWindow(t *testing.T) {
+	for window, want := range map[time.Duration]string{
+		24 * time.Hour:     "1d",
+		7 * 24 * time.Hour: "7d",
+		36 * time.Hour:     "36h",
+		90 * time.Minute:   "90m",
+		90 * time.Second:   "1m30s",
+	} {
+		if got := formatWindow(window); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package webhook notifies webhooks when the health status of a component changes.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+)
+
+const redacted = "REDACTED"
+
+type Options struct {
+	// Urls are the webhook URLs that are notified of status changes.
+	Urls []string
+	// MaxRetries is the number of times a failed delivery is retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry. The delay doubles for every retry.
+	Backoff time.Duration
+	// Timeout is the timeout of a single delivery attempt.
+	Timeout time.Duration
+	// DeadLetterFile is the file undeliverable notifications are appended to.
+	// If empty undeliverable notifications are logged.
+	DeadLetterFile string
+}
+
+// Payload is the JSON body posted to webhooks.
+type Payload struct {
+	ComponentId    string     `json:"componentId"`
+	PreviousStatus api.Status `json:"previousStatus"`
+	Status         api.Status `json:"status"`
+	Output         string     `json:"output,omitempty"`
+	Links          []string   `json:"links,omitempty"`
+	Time           string     `json:"time"`
+}
+
+type deadLetter struct {
+	Url     string   `json:"url"`
+	Error   string   `json:"error"`
+	Time    string   `json:"time"`
+	Payload *Payload `json:"payload"`
+}
+
+// Notifier remembers the status of every component and posts a payload to the
+// configured webhooks when the status changes. Every webhook has its own queue,
+// so a webhook that is down doesn't delay notifications to the others.
+type Notifier struct {
+	options Options
+	client  *http.Client
+
+	// mu guards previous, closed and sending to the queues
+	mu       sync.Mutex
+	previous map[string]api.Status
+	closed   bool
+	queues   []chan *Payload
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	deadLetterMu sync.Mutex
+}
+
+// New creates a new notifier and starts delivering notifications.
+func New(options Options) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{
+		options:  options,
+		client:   &http.Client{Timeout: options.Timeout},
+		previous: make(map[string]api.Status),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for _, rawUrl := range options.Urls {
+		queue := make(chan *Payload, 100)
+		n.queues = append(n.queues, queue)
+		n.wg.Add(1)
+		go n.deliverAll(rawUrl, queue)
+	}
+	return n
+}
+
+// Observe queues a notification if the status of the component has changed
+// since the previous result. The first result of a component is not notified.
+// Results observed after the notifier is closed are ignored.
+func (n *Notifier) Observe(checkResult *healthcheck.CheckResult) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+
+	status := healthcheck.ComponentStatus(checkResult)
+	previous, ok := n.previous[checkResult.Name]
+	n.previous[checkResult.Name] = status
+	if !ok || previous == status {
+		return
+	}
+
+	payload := &Payload{
+		ComponentId:    checkResult.Name,
+		PreviousStatus: previous,
+		Status:         status,
+		Time:           api.FormatTime(checkResult.Time),
+	}
+	var outputs []string
+	for _, result := range checkResult.Results {
+		if result.Err != nil {
+			outputs = append(outputs, result.Err.Error())
+		}
+		payload.Links = append(payload.Links, result.Links...)
+	}
+	payload.Output = strings.Join(outputs, "; ")
+
+	for i, queue := range n.queues {
+		select {
+		case queue <- payload:
+		default:
+			n.deadLetter(n.options.Urls[i], payload, fmt.Errorf("queue is full"))
+		}
+	}
+}
+
+// Close stops accepting notifications and cancels deliveries and retries in
+// progress. It waits for the notifications that were not delivered to be dead-lettered.
+func (n *Notifier) Close() {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return
+	}
+	n.closed = true
+	n.cancel()
+	for _, queue := range n.queues {
+		close(queue)
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+// deliverAll delivers the notifications in queue to rawUrl.
+func (n *Notifier) deliverAll(rawUrl string, queue <-chan *Payload) {
+	defer n.wg.Done()
+	for payload := range queue {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("failed to marshal webhook payload: %v", err)
+			continue
+		}
+		if err := n.deliver(rawUrl, body); err != nil {
+			n.deadLetter(rawUrl, payload, err)
+		}
+	}
+}
+
+// deliver posts body to rawUrl, retrying with exponential backoff.
+func (n *Notifier) deliver(rawUrl string, body []byte) error {
+	backoff := n.options.Backoff
+	var err error
+	for attempt := 0; attempt <= n.options.MaxRetries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-n.ctx.Done():
+				timer.Stop()
+				return err
+			}
+			backoff *= 2
+		}
+		if err = n.post(rawUrl, body); err == nil {
+			return nil
+		}
+		log.Printf("failed to deliver webhook to %s (attempt %d): %v", RedactUrl(rawUrl), attempt+1, err)
+	}
+	return err
+}
+
+func (n *Notifier) post(rawUrl string, body []byte) error {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, rawUrl, bytes.NewReader(body))
+	if err != nil {
+		return redactError(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return redactError(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	return nil
+}
+
+// redactError redacts the URL of err if it has one.
+func redactError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		urlErr.URL = RedactUrl(urlErr.URL)
+	}
+	return err
+}
+
+// deadLetter records a notification that could not be delivered.
+func (n *Notifier) deadLetter(rawUrl string, payload *Payload, err error) {
+	entry, _ := json.Marshal(deadLetter{
+		Url:     RedactUrl(rawUrl),
+		Error:   err.Error(),
+		Time:    api.GetCurrentTime(),
+		Payload: payload,
+	})
+	if n.options.DeadLetterFile == "" {
+		log.Printf("undeliverable webhook: %s", entry)
+		return
+	}
+
+	n.deadLetterMu.Lock()
+	defer n.deadLetterMu.Unlock()
+
+	f, err := os.OpenFile(n.options.DeadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("failed to open dead letter file: %v: undeliverable webhook: %s", err, entry)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if _, err := f.Write(append(entry, '\n')); err != nil {
+		log.Printf("failed to write dead letter file: %v: undeliverable webhook: %s", err, entry)
+	}
+}
+
+// RedactUrl redacts everything after the host of a webhook URL, since webhooks
+// are often authenticated by a secret in the path or query, and the password
+// of the URL if it has one.
+func RedactUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	r := &url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			r.User = url.UserPassword(u.User.Username(), redacted)
+		}
+	}
+	if strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+		r.Path = "/" + redacted
+	}
+	return r.String()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/maintenance"
+	"github.com/spf13/viper"
+)
+
+// reloadDelay is how long to wait for more changes before reloading, so a
+// file is not read while it is being written.
+const reloadDelay = 500 * time.Millisecond
+
+// configuration keys that are applied by a reload, the other keys require a restart
+var reloadedKeys = map[string]bool{
+	"veidemann-dashboard-url":           true,
+	"controller-host":                   true,
+	"controller-port":                   true,
+	"controller-auth":                   true,
+	"controller-api-key":                true,
+	"controller-oidc-token-url":         true,
+	"controller-oidc-client-id":         true,
+	"controller-oidc-client-secret":     true,
+	"controller-oidc-scopes":            true,
+	"controller-allow-insecure-api-key": true,
+	"controller-tls":                    true,
+	"controller-ca-cert":                true,
+	"controller-server-name":            true,
+	"controller-client-cert":            true,
+	"controller-client-key":             true,
+	"controller-keepalive":              true,
+	"controller-max-backoff":            true,
+	"prometheus-url":                    true,
+	"crawl-log-window":                  true,
+	"crawl-log-max-entries":             true,
+	"crawl-log-warn-rate":               true,
+	"crawl-log-fail-rate":               true,
+	"schedule-window":                   true,
+	"schedule-warn-after":               true,
+	"schedule-fail-after":               true,
+	"check-interval":                    true,
+	"check-intervals":                   true,
+	"stale-limit":                       true,
+	"prometheus-checks":                 true,
+	"veidemann-api-url":                 true,
+	"grpc-health-services":              true,
+	"targets":                           true,
+	"maintenance-windows":               true,
+}
+
+// reloader replaces the health checker of a scheduler and the configured
+// maintenance windows when the configuration changes.
+type reloader struct {
+	scheduler   *healthcheck.Scheduler
+	maintenance *maintenance.Maintenance
+	// config is the configuration the process was started with
+	config *Config
+	// windows are the maintenance windows of the current configuration
+	windows  []maintenance.Window
+	requests chan string
+}
+
+// watchConfig reloads the configuration when the configuration file changes
+// or the process receives SIGHUP. After watchConfig is called viper must only
+// be used by the reloader.
+func watchConfig(scheduler *healthcheck.Scheduler, maintenanceWindows *maintenance.Maintenance, config *Config) {
+	r := &reloader{
+		scheduler:   scheduler,
+		maintenance: maintenanceWindows,
+		config:      config,
+		windows:     config.MaintenanceWindows,
+		requests:    make(chan string, 1),
+	}
+
+	if configFile := viper.ConfigFileUsed(); configFile != "" {
+		if err := r.watchFile(configFile); err != nil {
+			log.Printf("failed to watch configuration file: %v", err)
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			r.request("received SIGHUP")
+		}
+	}()
+
+	go r.run()
+}
+
+// watchFile requests a reload when the file changes. The directory of the file
+// is watched, since editors and Kubernetes replace files instead of writing to them.
+func (r *reloader) watchFile(file string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	file = filepath.Clean(file)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+	realPath, _ := filepath.EvalSymlinks(file)
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// a mounted config map is updated by replacing the symlinked data directory
+				currentPath, _ := filepath.EvalSymlinks(file)
+				changed := filepath.Clean(event.Name) == file && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				if changed || (currentPath != "" && currentPath != realPath) {
+					realPath = currentPath
+					r.request(file + " changed")
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("failed to watch configuration file: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// request requests a reload. Requests that arrive while a reload is pending are merged.
+func (r *reloader) request(reason string) {
+	select {
+	case r.requests <- reason:
+	default:
+	}
+}
+
+func (r *reloader) run() {
+	for reason := range r.requests {
+		time.Sleep(reloadDelay)
+		select {
+		case <-r.requests:
+		default:
+		}
+		log.Printf("reloading configuration: %s", reason)
+		if err := r.reload(); err != nil {
+			log.Printf("rejected configuration, keeping the current configuration: %v", err)
+		} else {
+			log.Printf("reloaded configuration")
+		}
+	}
+}
+
+// reload reads the configuration and replaces the health checker of the
+// scheduler and the configured maintenance windows. If the configuration is
+// invalid the current health checker and windows are kept. Changes to keys
+// that are not applied by a reload are logged.
+func (r *reloader) reload() error {
+	if viper.ConfigFileUsed() != "" {
+		if err := viper.ReadInConfig(); err != nil {
+			return err
+		}
+	}
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	healthChecker, err := config.newHealthChecker()
+	if err != nil {
+		return err
+	}
+	if err := r.maintenance.Configure(config.MaintenanceWindows); err != nil {
+		_ = healthChecker.Close()
+		return err
+	}
+	old, err := r.scheduler.Reload(healthChecker, config.schedulerOptions())
+	if err != nil {
+		_ = healthChecker.Close()
+		// the previous windows were valid
+		_ = r.maintenance.Configure(r.windows)
+		return err
+	}
+	r.windows = config.MaintenanceWindows
+	if err := old.Close(); err != nil {
+		log.Println(err)
+	}
+	if keys := restartKeys(r.config, config); len(keys) > 0 {
+		log.Printf("changes to %s require a restart", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// restartKeys returns the keys that are not applied by a reload and have
+// different values in the configurations a and b.
+func restartKeys(a, b *Config) []string {
+	aValues := configValue(reflect.ValueOf(*a)).(map[string]interface{})
+	bValues := configValue(reflect.ValueOf(*b)).(map[string]interface{})
+	var keys []string
+	for _, key := range configKeys() {
+		if !reloadedKeys[key] && !reflect.DeepEqual(aValues[key], bValues[key]) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
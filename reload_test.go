@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/maintenance"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// testConfig is a valid configuration with the URL of the dashboard and Prometheus as argument.
+const testConfig = `
+port: "8080"
+health-path: /health
+liveness-path: /healthz
+metrics-path: /metrics
+maintenance-path: /maintenance
+history-path: /health/history
+slo-path: /health/slo
+events-path: /health/events
+veidemann-dashboard-url: %[1]s
+prometheus-url: %[1]s
+# nothing listens on port 1, so the controller checks fail fast
+controller-host: 127.0.0.1
+controller-port: 1
+controller-max-backoff: 1s
+veidemann-api-url: 127.0.0.1:1
+crawl-log-window: 1m
+crawl-log-max-entries: 10
+schedule-window: 1h
+check-interval: 1h
+warn-status-code: 200
+webhook-timeout: 1s
+history-snapshot-interval: 1m
+history-snapshot-retention: 1h
+history-retention: 1h
+events-buffer-size: 10
+events-keepalive: 1s
+slo-target: 99
+`
+
+// writeConfig writes the test configuration followed by extra to file.
+func writeConfig(t *testing.T, file string, url string, extra string) {
+	t.Helper()
+	if err := ioutil.WriteFile(file, []byte(fmt.Sprintf(testConfig, url)+extra), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useConfig makes viper read the configuration from file.
+func useConfig(t *testing.T, file string) {
+	t.Helper()
+	viper.SetConfigFile(file)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// componentsWithSeries returns the components that have metrics in registry.
+func componentsWithSeries(t *testing.T, registry *prometheus.Registry) map[string]bool {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	components := make(map[string]bool)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "component" {
+					components[label.GetValue()] = true
+				}
+			}
+		}
+	}
+	return components
+}
+
+func TestReload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"scalar","result":[%d,"2"]}}`, time.Now().Unix())
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer viper.Reset()
+
+	file := filepath.Join(dir, "config.yaml")
+	writeConfig(t, file, server.URL, `
+prometheus-checks:
+  - id: test:a
+    query: x
+maintenance-windows:
+  - id: backup
+    cron: 0 3 * * *
+    duration: 1h
+`)
+	useConfig(t, file)
+	config, err := readConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthChecker, err := config.newHealthChecker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler, err := healthcheck.NewScheduler(healthChecker, config.schedulerOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	exporter, err := metrics.New(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler.Observe(exporter.Observe)
+	scheduler.Forget(exporter.Remove)
+	maintenanceWindows, err := maintenance.New(maintenance.Options{Windows: config.MaintenanceWindows})
+	if err != nil {
+		t.Fatal(err)
+	}
+	windowIds := func() []string {
+		var ids []string
+		for _, w := range maintenanceWindows.List() {
+			ids = append(ids, w.Id)
+		}
+		return ids
+	}
+
+	var mu sync.Mutex
+	checks := make(map[string]int)
+	scheduler.Observe(func(checkResult *healthcheck.CheckResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		checks[checkResult.Name]++
+	})
+	checksOf := func(id string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return checks[id]
+	}
+
+	scheduler.Start()
+	defer func() {
+		scheduler.Stop()
+		_ = scheduler.HealthChecker().Close()
+	}()
+	if !componentsWithSeries(t, registry)["test:a"] {
+		t.Fatal("expected metrics of test:a")
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	// replace test:a with test:b, which is checked more often than the others
+	writeConfig(t, file, server.URL, `
+prometheus-checks:
+  - id: test:b
+    query: x
+check-intervals:
+  test:b: 10ms
+warn-status-code: 207
+webhook-urls:
+  - https://example.org/hook
+maintenance-windows:
+  - id: restart
+    cron: 0 4 * * *
+    duration: 30m
+`)
+	r := &reloader{scheduler: scheduler, maintenance: maintenanceWindows, config: config, windows: config.MaintenanceWindows}
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := scheduler.ComponentSnapshot("test:a"); ok {
+		t.Error("expected test:a to be removed")
+	}
+	if _, ok := scheduler.ComponentSnapshot("test:b"); !ok {
+		t.Error("expected test:b to be added")
+	}
+	if components := componentsWithSeries(t, registry); components["test:a"] || !components["test:b"] {
+		t.Errorf("expected metrics of test:b instead of test:a, got %v", components)
+	}
+	if checksOf(healthcheck.VeidemannDashboard) != 2 {
+		t.Errorf("expected the dashboard to be checked at start and reload, got %d checks", checksOf(healthcheck.VeidemannDashboard))
+	}
+	for deadline := time.Now().Add(5 * time.Second); checksOf("test:b") < 3; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected test:b to be checked every 10ms, got %d checks", checksOf("test:b"))
+		}
+	}
+	if want := "changes to warn-status-code, webhook-urls require a restart"; !strings.Contains(logs.String(), want) {
+		t.Errorf("expected log %q, got %s", want, logs.String())
+	}
+	if ids := windowIds(); len(ids) != 1 || ids[0] != "restart" {
+		t.Errorf("expected maintenance window restart, got %v", ids)
+	}
+
+	// an invalid configuration is rejected and the current checks are kept
+	for _, invalid := range []string{`
+check-interval: -1s
+`, `
+maintenance-windows:
+  - id: backup
+    cron: 0 3 * * *
+`} {
+		writeConfig(t, file, server.URL, invalid)
+		if err := r.reload(); err == nil {
+			t.Error("expected invalid configuration to be rejected")
+		}
+		if _, ok := scheduler.ComponentSnapshot("test:b"); !ok {
+			t.Error("expected test:b to be kept")
+		}
+		if ids := windowIds(); len(ids) != 1 || ids[0] != "restart" {
+			t.Errorf("expected maintenance window restart to be kept, got %v", ids)
+		}
+	}
+}
+
+func TestReloadedKeys(t *testing.T) {
+	keys := make(map[string]bool)
+	for _, key := range configKeys() {
+		keys[key] = true
+	}
+	for key := range reloadedKeys {
+		if !keys[key] {
+			t.Errorf("unknown configuration key: %s", key)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	htmlTemplate "html/template"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+)
+
+const (
+	mediaTypeHealthJson = "application/health+json"
+	mediaTypeJson       = "application/json"
+	mediaTypeHtml       = "text/html"
+	mediaTypeText       = "text/plain"
+)
+
+// offered media types in order of preference
+var offers = []string{mediaTypeHealthJson, mediaTypeJson, mediaTypeHtml, mediaTypeText}
+
+// negotiate returns the offered media type that is preferred by the Accept
+// header. Health JSON is returned if the header is empty or nothing offered is acceptable.
+func negotiate(accept string) string {
+	best := mediaTypeHealthJson
+	bestQ := 0.0
+	for _, offer := range offers {
+		q := acceptQuality(accept, offer)
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality value the Accept header gives mediaType.
+// The most specific matching media range counts.
+func acceptQuality(accept string, mediaType string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+	q := 0.0
+	specificity := -1
+	for _, mediaRange := range strings.Split(accept, ",") {
+		rangeType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		s := -1
+		switch {
+		case rangeType == mediaType:
+			s = 2
+		case rangeType == "*/*":
+			s = 0
+		case strings.HasSuffix(rangeType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(rangeType, "*")):
+			s = 1
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity = s
+		q = 1
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return q
+}
+
+// formatValue formats an observed value for display.
+func formatValue(value api.Value, unit string) string {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case float32, int, int32, int64, bool:
+		s = fmt.Sprint(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			s = fmt.Sprint(v)
+		} else {
+			s = string(b)
+		}
+	}
+	if unit != "" && s != "" {
+		s += " " + unit
+	}
+	return s
+}
+
+// statusText returns status or "-" if status is undefined.
+func statusText(status api.Status) string {
+	if status == "" {
+		return "-"
+	}
+	return string(status)
+}
+
+var templateFuncs = map[string]interface{}{
+	"value":  formatValue,
+	"status": statusText,
+}
+
+var htmlPage = htmlTemplate.Must(htmlTemplate.New("health").Funcs(templateFuncs).Parse(htmlPageTemplate))
+
+var textSummary = textTemplate.Must(textTemplate.New("health").Funcs(templateFuncs).Parse(textSummaryTemplate))
+
+// render writes health in the given media type.
+func render(w io.Writer, mediaType string, health *api.Health) error {
+	switch mediaType {
+	case mediaTypeHtml:
+		return htmlPage.Execute(w, health)
+	case mediaTypeText:
+		return textSummary.Execute(w, health)
+	default:
+		return json.NewEncoder(w).Encode(health)
+	}
+}
+
+const textSummaryTemplate = `{{status .Status}}{{if .Version}} (version {{.Version}}){{end}}
+{{range $name, $checks := .Checks}}{{range $checks}}{{printf "%-5s" (status .Status)}} {{$name}}{{if .ComponentId}} [{{.ComponentId}}]{{end}}{{with value .ObservedValue .ObservedUnit}} = {{.}}{{end}}{{if .Stale}} (stale){{end}}{{with .Output}}: {{.}}{{end}}
+{{end}}{{end}}`
+
+const htmlPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Veidemann health: {{status .Status}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4em .6em; border-bottom: 1px solid #ddd; vertical-align: top; }
+th { background: #f4f4f4; }
+td.value { font-family: monospace; word-break: break-all; }
+.status { font-weight: bold; text-transform: uppercase; }
+.up { color: #1b7f3b; }
+.warn { color: #b86e00; }
+.down { color: #c62828; }
+tr.warn { background: #fff8e1; }
+tr.down { background: #ffebee; }
+.stale { color: #777; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>Veidemann health: <span class="status {{.Status}}">{{status .Status}}</span></h1>
+{{if .Version}}<p>Version {{.Version}}</p>{{end}}
+{{with .Notes}}<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>{{end}}
+<table>
+<thead>
+<tr><th>Component</th><th>Id</th><th>Type</th><th>Status</th><th>Observed value</th><th>Output</th><th>Time</th><th>Links</th></tr>
+</thead>
+<tbody>
+{{range $name, $checks := .Checks}}{{range $checks}}<tr class="{{.Status}}">
+<td>{{$name}}</td>
+<td>{{.ComponentId}}</td>
+<td>{{.ComponentType}}</td>
+<td class="status {{.Status}}">{{status .Status}}</td>
+<td class="value">{{value .ObservedValue .ObservedUnit}}</td>
+<td>{{.Output}}</td>
+<td>{{.Time}}{{if .Age}} ({{.Age}} ago){{end}}{{if .Stale}} <span class="stale">stale</span>{{end}}</td>
+<td>{{range .Links}}<a href="{{.}}">{{.}}</a><br>{{end}}</td>
+</tr>
+{{end}}{{end}}</tbody>
+</table>
+</body>
+</html>
+`
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/api"
+)
+
+func TestAcceptQuality(t *testing.T) {
+	tests := []struct {
+		accept    string
+		mediaType string
+		q         float64
+	}{
+		{"", mediaTypeHtml, 1},
+		{"text/html", mediaTypeHtml, 1},
+		{"text/html", mediaTypeText, 0},
+		{"text/html;q=0.5", mediaTypeHtml, 0.5},
+		{"text/html; q=0.5", mediaTypeHtml, 0.5},
+		{"text/*;q=0.3", mediaTypeText, 0.3},
+		{"*/*;q=0.1", mediaTypeJson, 0.1},
+		// the most specific media range counts regardless of order
+		{"text/html;q=0.2, text/*;q=0.8, */*", mediaTypeHtml, 0.2},
+		{"*/*, text/*;q=0.8, text/html;q=0.2", mediaTypeHtml, 0.2},
+		{"*/*;q=0.5, text/*;q=0.8", mediaTypeText, 0.8},
+		{"text/*", mediaTypeJson, 0},
+		{"text/html;q=0", mediaTypeHtml, 0},
+		// an invalid quality value counts as 1 and an invalid media range is ignored
+		{"text/html;q=high", mediaTypeHtml, 1},
+		{"text/html;;, text/plain", mediaTypeText, 1},
+	}
+	for _, test := range tests {
+		if q := acceptQuality(test.accept, test.mediaType); q != test.q {
+			t.Errorf("%s for %q: expected %v, got %v", test.mediaType, test.accept, test.q, q)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept    string
+		mediaType string
+	}{
+		{"", mediaTypeHealthJson},
+		{"*/*", mediaTypeHealthJson},
+		{"application/json", mediaTypeJson},
+		{"application/health+json", mediaTypeHealthJson},
+		{"application/*", mediaTypeHealthJson},
+		{"application/health+json;q=0.5, application/json", mediaTypeJson},
+		{"text/html", mediaTypeHtml},
+		{"text/plain", mediaTypeText},
+		// offers with the same quality are chosen in order of preference
+		{"text/*", mediaTypeHtml},
+		{"text/plain, text/html", mediaTypeHtml},
+		{"text/html;q=0.5, text/plain", mediaTypeText},
+		// browsers
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", mediaTypeHtml},
+		// q=0 means not acceptable
+		{"text/html;q=0, */*", mediaTypeHealthJson},
+		{"*/*;q=0, text/plain", mediaTypeText},
+		// nothing offered is acceptable
+		{"image/png", mediaTypeHealthJson},
+		{"text/html;q=0", mediaTypeHealthJson},
+		{"not a media type", mediaTypeHealthJson},
+	}
+	for _, test := range tests {
+		if mediaType := negotiate(test.accept); mediaType != test.mediaType {
+			t.Errorf("%q: expected %s, got %s", test.accept, test.mediaType, mediaType)
+		}
+	}
+}
+
+func testHealth() *api.Health {
+	return &api.Health{
+		Status:  api.StatusWarn,
+		Version: "1.0.0",
+		Checks: api.Checks{
+			"veidemann:crawllog": {{
+				ComponentType: "harvester",
+				Status:        api.StatusWarn,
+				ObservedValue: 0.25,
+				ObservedUnit:  "%",
+				Output:        "<script>alert(1)</script>",
+				Stale:         true,
+			}},
+			"veidemann:jobs": {
+				{ComponentId: "jes-1", Status: api.StatusHealthy, ObservedValue: map[string]string{"state": "RUNNING"}, Links: []string{"https://veidemann.example.org/jes-1"}},
+				{ComponentId: "jes-2"},
+			},
+		},
+	}
+}
+
+func TestRenderJson(t *testing.T) {
+	for _, mediaType := range []string{mediaTypeHealthJson, mediaTypeJson} {
+		var buf bytes.Buffer
+		if err := render(&buf, mediaType, testHealth()); err != nil {
+			t.Fatal(err)
+		}
+		var health api.Health
+		if err := json.Unmarshal(buf.Bytes(), &health); err != nil {
+			t.Fatalf("%s: %v", mediaType, err)
+		}
+		if health.Status != api.StatusWarn || len(health.Checks["veidemann:jobs"]) != 2 {
+			t.Errorf("%s: unexpected health: %+v", mediaType, health)
+		}
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := render(&buf, mediaTypeText, testHealth()); err != nil {
+		t.Fatal(err)
+	}
+	want := `warn (version 1.0.0)
+warn  veidemann:crawllog = 0.25 % (stale): <script>alert(1)</script>
+up    veidemann:jobs [jes-1] = {"state":"RUNNING"}
+-     veidemann:jobs [jes-2]
+`
+	if buf.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
+
+func TestRenderHtml(t *testing.T) {
+	var buf bytes.Buffer
+	if err := render(&buf, mediaTypeHtml, testHealth()); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, want := range []string{
+		"<title>Veidemann health: warn</title>",
+		`<td class="status warn">warn</td>`,
+		`<td class="value">0.25 %</td>`,
+		// output is escaped
+		"<td>&lt;script&gt;alert(1)&lt;/script&gt;</td>",
+		`<span class="stale">stale</span>`,
+		`<a href="https://veidemann.example.org/jes-1">`,
+		`<td class="status ">-</td>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected page to contain %s", want)
+		}
+	}
+	if strings.Contains(page, "<script>") {
+		t.Error("expected no script element")
+	}
+}
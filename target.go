@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/grpc"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+)
+
+// Target is a Veidemann installation. Options that are not set are taken from
+// the top level of the configuration.
+type Target struct {
+	Name                          string                        `mapstructure:"name"`
+	VeidemannDashboardUrl         string                        `mapstructure:"veidemann-dashboard-url"`
+	ControllerHost                string                        `mapstructure:"controller-host"`
+	ControllerPort                int                           `mapstructure:"controller-port"`
+	ControllerAuth                string                        `mapstructure:"controller-auth"`
+	ControllerApiKey              string                        `mapstructure:"controller-api-key"`
+	ControllerOIDCTokenUrl        string                        `mapstructure:"controller-oidc-token-url"`
+	ControllerOIDCClientId        string                        `mapstructure:"controller-oidc-client-id"`
+	ControllerOIDCClientSecret    string                        `mapstructure:"controller-oidc-client-secret"`
+	ControllerOIDCScopes          []string                      `mapstructure:"controller-oidc-scopes"`
+	ControllerAllowInsecureApiKey *bool                         `mapstructure:"controller-allow-insecure-api-key"`
+	ControllerTLS                 *bool                         `mapstructure:"controller-tls"`
+	ControllerCACert              string                        `mapstructure:"controller-ca-cert"`
+	ControllerServerName          string                        `mapstructure:"controller-server-name"`
+	ControllerClientCert          string                        `mapstructure:"controller-client-cert"`
+	ControllerClientKey           string                        `mapstructure:"controller-client-key"`
+	PrometheusUrl                 string                        `mapstructure:"prometheus-url"`
+	PrometheusChecks              []healthcheck.PrometheusCheck `mapstructure:"prometheus-checks"`
+	VeidemannApiUrl               string                        `mapstructure:"veidemann-api-url"`
+	GrpcHealthServices            []grpc.Service                `mapstructure:"grpc-health-services"`
+}
+
+func setString(option *string, value string) {
+	if value != "" {
+		*option = value
+	}
+}
+
+func setBool(option *bool, value *bool) {
+	if value != nil {
+		*option = *value
+	}
+}
+
+// healthCheckerOptions returns options with the options set for the target replaced.
+func (target *Target) healthCheckerOptions(options healthcheck.Options) healthcheck.Options {
+	setString(&options.WebOptions.VeidemannDashboardUrl, target.VeidemannDashboardUrl)
+	setString(&options.Controller.Host, target.ControllerHost)
+	if target.ControllerPort != 0 {
+		options.Controller.Port = target.ControllerPort
+	}
+	setString(&options.Controller.Auth, target.ControllerAuth)
+	setString(&options.Controller.ApiKey, target.ControllerApiKey)
+	setString(&options.Controller.OIDC.TokenUrl, target.ControllerOIDCTokenUrl)
+	setString(&options.Controller.OIDC.ClientId, target.ControllerOIDCClientId)
+	setString(&options.Controller.OIDC.ClientSecret, target.ControllerOIDCClientSecret)
+	if target.ControllerOIDCScopes != nil {
+		options.Controller.OIDC.Scopes = target.ControllerOIDCScopes
+	}
+	setBool(&options.Controller.AllowInsecureApiKey, target.ControllerAllowInsecureApiKey)
+	setBool(&options.Controller.TLS.Enabled, target.ControllerTLS)
+	setString(&options.Controller.TLS.CACert, target.ControllerCACert)
+	setString(&options.Controller.TLS.ServerNameOverride, target.ControllerServerName)
+	setString(&options.Controller.TLS.ClientCert, target.ControllerClientCert)
+	setString(&options.Controller.TLS.ClientKey, target.ControllerClientKey)
+	setString(&options.Prometheus.Address, target.PrometheusUrl)
+	if target.PrometheusChecks != nil {
+		options.PrometheusChecks = target.PrometheusChecks
+	}
+	setString(&options.Grpc.VeidemannApiUrl, target.VeidemannApiUrl)
+	if target.GrpcHealthServices != nil {
+		options.GrpcServices = target.GrpcHealthServices
+	}
+	return options
+}
+
+// newHealthChecker creates the health checker of the configuration. If targets
+// are configured, a health checker is created for every target and combined.
+func (config *Config) newHealthChecker() (*healthcheck.HealthChecker, error) {
+	options := config.healthCheckerOptions()
+	if len(config.Targets) == 0 {
+		return healthcheck.NewHealthChecker(&options)
+	}
+
+	targets := make(map[string]*healthcheck.HealthChecker)
+	closeTargets := func() {
+		for _, hc := range targets {
+			_ = hc.Close()
+		}
+	}
+	for _, target := range config.Targets {
+		if _, ok := targets[target.Name]; ok {
+			closeTargets()
+			return nil, fmt.Errorf("duplicate target: %s", target.Name)
+		}
+		targetOptions := target.healthCheckerOptions(options)
+		hc, err := healthcheck.NewHealthChecker(&targetOptions)
+		if err != nil {
+			closeTargets()
+			return nil, fmt.Errorf("target %s: %w", target.Name, err)
+		}
+		targets[target.Name] = hc
+	}
+	hc, err := healthcheck.Combine(targets)
+	if err != nil {
+		closeTargets()
+		return nil, err
+	}
+	return hc, nil
+}
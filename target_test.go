@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/controller"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/grpc"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/prometheus"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/client/web"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+)
+
+func TestTargetHealthCheckerOptions(t *testing.T) {
+	yes, no := true, false
+	defaults := healthcheck.Options{
+		WebOptions: web.Options{VeidemannDashboardUrl: "https://veidemann.example.org/veidemann"},
+		Controller: controller.Options{
+			Host:   "veidemann-controller",
+			Port:   7700,
+			Auth:   "apikey",
+			ApiKey: "secret",
+			OIDC:   controller.OIDCOptions{Scopes: []string{"openid"}},
+			TLS:    controller.TLSOptions{Enabled: true, CACert: "ca.pem"},
+		},
+		CrawlLog:         healthcheck.CrawlLogOptions{Window: 5 * time.Minute, MaxEntries: 1000},
+		Prometheus:       prometheus.Options{Address: "http://prometheus:9090"},
+		PrometheusChecks: []healthcheck.PrometheusCheck{{Id: "veidemann:queue", Query: "x"}},
+		Grpc:             grpc.Options{VeidemannApiUrl: "veidemann-api:7700"},
+		GrpcServices:     []grpc.Service{{Name: "frontier"}},
+	}
+
+	tests := []struct {
+		name   string
+		target Target
+		modify func(options *healthcheck.Options)
+	}{
+		{"no overrides", Target{Name: "webarchive"}, func(*healthcheck.Options) {}},
+		{"strings and port", Target{
+			Name:                  "newscrawl",
+			VeidemannDashboardUrl: "https://newscrawl.example.org/veidemann",
+			ControllerHost:        "newscrawl-controller",
+			ControllerPort:        8443,
+			ControllerApiKey:      "other",
+			ControllerCACert:      "newscrawl-ca.pem",
+			PrometheusUrl:         "http://newscrawl-prometheus:9090",
+			VeidemannApiUrl:       "newscrawl-api:7700",
+		}, func(options *healthcheck.Options) {
+			options.WebOptions.VeidemannDashboardUrl = "https://newscrawl.example.org/veidemann"
+			options.Controller.Host = "newscrawl-controller"
+			options.Controller.Port = 8443
+			options.Controller.ApiKey = "other"
+			options.Controller.TLS.CACert = "newscrawl-ca.pem"
+			options.Prometheus.Address = "http://newscrawl-prometheus:9090"
+			options.Grpc.VeidemannApiUrl = "newscrawl-api:7700"
+		}},
+		{"oidc", Target{
+			Name:                       "newscrawl",
+			ControllerAuth:             "oidc",
+			ControllerOIDCTokenUrl:     "https://idp.example.org/token",
+			ControllerOIDCClientId:     "health",
+			ControllerOIDCClientSecret: "secret",
+			ControllerOIDCScopes:       []string{"openid", "veidemann"},
+		}, func(options *healthcheck.Options) {
+			options.Controller.Auth = "oidc"
+			options.Controller.OIDC = controller.OIDCOptions{
+				TokenUrl:     "https://idp.example.org/token",
+				ClientId:     "health",
+				ClientSecret: "secret",
+				Scopes:       []string{"openid", "veidemann"},
+			}
+		}},
+		// a boolean that is set to false overrides true
+		{"booleans", Target{Name: "newscrawl", ControllerTLS: &no, ControllerAllowInsecureApiKey: &yes}, func(options *healthcheck.Options) {
+			options.Controller.TLS.Enabled = false
+			options.Controller.AllowInsecureApiKey = true
+		}},
+		// empty lists replace the lists of the top level
+		{"lists", Target{
+			Name:               "newscrawl",
+			PrometheusChecks:   []healthcheck.PrometheusCheck{},
+			GrpcHealthServices: []grpc.Service{{Name: "harvester"}},
+		}, func(options *healthcheck.Options) {
+			options.PrometheusChecks = []healthcheck.PrometheusCheck{}
+			options.GrpcServices = []grpc.Service{{Name: "harvester"}}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := defaults
+			test.modify(&want)
+			if got := test.target.healthCheckerOptions(defaults); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+		})
+	}
+	if defaults.Controller.Host != "veidemann-controller" || !defaults.Controller.TLS.Enabled {
+		t.Error("expected the options of the top level not to be modified")
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/healthcheck"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/maintenance"
+	"github.com/nlnwa/veidemann-health-check-api/pkg/webhook"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configuration keys with values that are redacted when the configuration is printed
+var secretKeys = map[string]bool{
+	"controller-api-key":            true,
+	"controller-oidc-client-secret": true,
+	"maintenance-token":             true,
+}
+
+const redacted = "REDACTED"
+
+// problem is an invalid configuration value.
+type problem struct {
+	key     string
+	source  string
+	message string
+}
+
+func (p problem) String() string {
+	return fmt.Sprintf("%s (%s): %s", p.key, p.source, p.message)
+}
+
+// invalidConfigError is returned when the configuration has problems.
+type invalidConfigError []problem
+
+func (e invalidConfigError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("invalid configuration:")
+	for _, p := range e {
+		sb.WriteString("\n\t" + p.String())
+	}
+	return sb.String()
+}
+
+// configSource returns where the value of key is set, following the
+// precedence of viper: flag, environment variable, configuration file and default.
+func configSource(key string) string {
+	if f := flag.Lookup(key); f != nil && f.Changed {
+		return "flag --" + key
+	}
+	env := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+	if value, ok := os.LookupEnv(env); ok && value != "" {
+		return "env " + env
+	}
+	if file := viper.ConfigFileUsed(); file != "" && viper.InConfig(key) {
+		return "file " + file
+	}
+	return "default"
+}
+
+// configKeys returns the configuration key of every field of Config.
+func configKeys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, t.NumField())
+	for i := range keys {
+		keys[i] = fieldKey(t.Field(i))
+	}
+	return keys
+}
+
+// fieldKey returns the key a struct field is decoded from.
+func fieldKey(field reflect.StructField) string {
+	if tag := strings.Split(field.Tag.Get("mapstructure"), ",")[0]; tag != "" {
+		return tag
+	}
+	return strings.ToLower(field.Name)
+}
+
+// validator collects the problems of a configuration.
+type validator struct {
+	problems []problem
+	// keys that could not be decoded and are not checked further
+	invalid map[string]bool
+}
+
+func (v *validator) add(key string, format string, args ...interface{}) {
+	v.problems = append(v.problems, problem{
+		key:     key,
+		source:  configSource(key),
+		message: fmt.Sprintf(format, args...),
+	})
+}
+
+// check adds a problem if key was decoded and ok is false.
+func (v *validator) check(key string, ok bool, format string, args ...interface{}) {
+	if !ok && !v.invalid[key] {
+		v.add(key, format, args...)
+	}
+}
+
+func (v *validator) positive(key string, d time.Duration) {
+	v.check(key, d > 0, "duration must be positive: %v", d)
+}
+
+func (v *validator) notNegative(key string, d time.Duration) {
+	v.check(key, d >= 0, "duration must not be negative: %v", d)
+}
+
+func (v *validator) port(key string, port int) {
+	v.check(key, port > 0 && port <= 65535, "invalid port: %d", port)
+}
+
+func (v *validator) path(key string, path string) {
+	v.check(key, strings.HasPrefix(path, "/"), "path must start with /: %q", path)
+}
+
+// routes checks that no two endpoints are registered with the same pattern,
+// which the router doesn't allow. Paths ending with a slash serve the subtree.
+func (v *validator) routes(config *Config) {
+	routes := map[string]string{}
+	conflicts := map[[2]string]bool{}
+	route := func(key string, pattern string) {
+		other, ok := routes[pattern]
+		if !ok {
+			routes[pattern] = key
+			return
+		}
+		if other == key || conflicts[[2]string{other, key}] {
+			return
+		}
+		conflicts[[2]string{other, key}] = true
+		// report the conflict on the path that was changed from the default
+		if configSource(key) == "default" && configSource(other) != "default" {
+			key, other = other, key
+		}
+		v.check(key, false, "path %q is already used by %s", pattern, other)
+	}
+	subtree := func(key string, path string) {
+		route(key, path)
+		route(key, strings.TrimSuffix(path, "/")+"/")
+	}
+	route("liveness-path", config.LivenessPath)
+	route("metrics-path", config.MetricsPath)
+	subtree("maintenance-path", config.MaintenancePath)
+	subtree("health-path", config.HealthPath)
+	if config.HistoryFile != "" {
+		route("history-path", config.HistoryPath)
+		route("slo-path", config.SloPath)
+	}
+	route("events-path", config.EventsPath)
+}
+
+// url checks that rawUrl is an absolute http or https URL.
+func (v *validator) url(key string, rawUrl string) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		// the error contains the URL
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		v.check(key, false, "invalid URL %q: %v", redact(key, rawUrl), err)
+		return
+	}
+	v.check(key, (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "not an http or https URL: %q", redact(key, rawUrl))
+}
+
+func (v *validator) address(key string, address string) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		v.check(key, false, "%v", err)
+		return
+	}
+	n, err := strconv.Atoi(port)
+	v.check(key, err == nil && n > 0 && n <= 65535, "invalid port in address: %q", address)
+}
+
+// validateConfig decodes the configuration from viper. Every unknown key and
+// invalid value is returned as a problem.
+func validateConfig() (*Config, []problem) {
+	v := &validator{invalid: make(map[string]bool)}
+
+	keys := configKeys()
+	known := make(map[string]bool)
+	for _, key := range keys {
+		known[key] = true
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		known[f.Name] = true
+	})
+	var unknown []string
+	for _, key := range viper.AllKeys() {
+		key = strings.Split(key, ".")[0]
+		if !known[key] {
+			known[key] = true
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		v.add(key, "unknown key")
+	}
+
+	var config Config
+	value := reflect.ValueOf(&config).Elem()
+	for i, key := range keys {
+		field := value.Field(i)
+		target := reflect.New(field.Type())
+		err := viper.UnmarshalKey(key, target.Interface(), func(c *mapstructure.DecoderConfig) {
+			c.ErrorUnused = true
+		})
+		if err == nil {
+			field.Set(target.Elem())
+			continue
+		}
+		v.invalid[key] = true
+		messages := []string{err.Error()}
+		if decodeErr, ok := err.(*mapstructure.Error); ok {
+			messages = decodeErr.Errors
+		}
+		for _, message := range messages {
+			// the decoded value is the key itself, so its name in messages is empty
+			message = strings.Replace(message, "error decoding '': ", "", 1)
+			v.add(key, "%s", strings.TrimPrefix(message, "'' "))
+		}
+	}
+
+	if port, err := strconv.Atoi(config.Port); err != nil {
+		v.check("port", false, "invalid port: %q", config.Port)
+	} else {
+		v.port("port", port)
+	}
+	v.path("health-path", config.HealthPath)
+	v.path("liveness-path", config.LivenessPath)
+	v.path("metrics-path", config.MetricsPath)
+	v.path("maintenance-path", config.MaintenancePath)
+	v.path("history-path", config.HistoryPath)
+	v.path("slo-path", config.SloPath)
+	v.path("events-path", config.EventsPath)
+	v.routes(&config)
+	v.url("veidemann-dashboard-url", config.VeidemannDashboardUrl)
+	v.url("prometheus-url", config.PrometheusUrl)
+	if config.ControllerOIDCTokenUrl != "" {
+		v.url("controller-oidc-token-url", config.ControllerOIDCTokenUrl)
+	}
+	for _, webhookUrl := range config.WebhookUrls {
+		v.url("webhook-urls", webhookUrl)
+	}
+	v.check("controller-host", config.ControllerHost != "", "missing controller host")
+	v.port("controller-port", config.ControllerPort)
+	v.address("veidemann-api-url", config.VeidemannApiUrl)
+	for _, service := range config.GrpcHealthServices {
+		if service.Address != "" {
+			v.address("grpc-health-services", service.Address)
+		}
+	}
+	v.notNegative("controller-keepalive", config.ControllerKeepalive)
+	v.positive("controller-max-backoff", config.ControllerMaxBackoff)
+	v.positive("crawl-log-window", config.CrawlLogWindow)
+	v.positive("schedule-window", config.ScheduleWindow)
+	v.notNegative("schedule-warn-after", config.ScheduleWarnAfter)
+	v.notNegative("schedule-fail-after", config.ScheduleFailAfter)
+	v.positive("check-interval", config.CheckInterval)
+	for id, interval := range config.CheckIntervals {
+		v.check("check-intervals", interval > 0, "interval of %s must be positive: %v", id, interval)
+	}
+	v.notNegative("stale-limit", config.StaleLimit)
+	v.check("warn-status-code", config.WarnStatusCode >= 200 && config.WarnStatusCode <= 599,
+		"invalid warn status code: %d", config.WarnStatusCode)
+	v.check("webhook-max-retries", config.WebhookMaxRetries >= 0, "must not be negative: %d", config.WebhookMaxRetries)
+	v.notNegative("webhook-backoff", config.WebhookBackoff)
+	v.positive("webhook-timeout", config.WebhookTimeout)
+	v.positive("history-snapshot-interval", config.HistorySnapshotInterval)
+	v.positive("history-snapshot-retention", config.HistorySnapshotRetention)
+	v.positive("history-retention", config.HistoryRetention)
+	v.check("events-buffer-size", config.EventsBufferSize > 0, "must be positive: %d", config.EventsBufferSize)
+	v.positive("events-keepalive", config.EventsKeepalive)
+	v.check("slo-target", config.SloTarget > 0 && config.SloTarget < 100, "must be between 0 and 100: %v", config.SloTarget)
+	for _, window := range config.SloWindows {
+		v.positive("slo-windows", window)
+	}
+
+	names := make(map[string]bool)
+	for _, target := range config.Targets {
+		v.check("targets", target.Name != "" && !strings.Contains(target.Name, healthcheck.TargetSeparator),
+			"invalid target name: %q", target.Name)
+		v.check("targets", !names[target.Name], "duplicate target: %s", target.Name)
+		names[target.Name] = true
+		v.targetUrl(target.Name, "veidemann-dashboard-url", target.VeidemannDashboardUrl)
+		v.targetUrl(target.Name, "prometheus-url", target.PrometheusUrl)
+		v.targetUrl(target.Name, "controller-oidc-token-url", target.ControllerOIDCTokenUrl)
+		if target.ControllerPort != 0 {
+			v.check("targets", target.ControllerPort > 0 && target.ControllerPort <= 65535,
+				"invalid controller-port of target %q: %d", target.Name, target.ControllerPort)
+		}
+	}
+
+	return &config, v.problems
+}
+
+// targetUrl checks rawUrl like url if it is set for the target.
+func (v *validator) targetUrl(target string, key string, rawUrl string) {
+	if rawUrl == "" {
+		return
+	}
+	u, err := url.Parse(rawUrl)
+	v.check("targets", err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+		"%s of target %q is not an http or https URL: %q", key, target, redactUrl(rawUrl))
+}
+
+// validate validates the configuration, prints the problems found or the
+// effective configuration, and returns the exit code.
+func validate() int {
+	config, problems := validateConfig()
+	if len(problems) > 0 {
+		fmt.Fprintln(os.Stderr, invalidConfigError(problems).Error())
+		return 1
+	}
+
+	// validate the checks and maintenance windows without connecting
+	hc, err := config.newHealthChecker()
+	if err == nil {
+		_, err = healthcheck.NewScheduler(hc, config.schedulerOptions())
+		_ = hc.Close()
+	}
+	if err == nil {
+		_, err = maintenance.New(maintenance.Options{Windows: config.MaintenanceWindows})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(redactedConfig(config)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// redactedConfig returns config as a map with the configuration keys and
+// values as they are written in a configuration file, with secrets redacted.
+func redactedConfig(config *Config) map[string]interface{} {
+	return redact("", configValue(reflect.ValueOf(*config))).(map[string]interface{})
+}
+
+// redact redacts secrets and passwords in URLs in the value of key.
+func redact(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, element := range v {
+			v[k] = redact(k, element)
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = redact(key, element)
+		}
+	case string:
+		if secretKeys[key] && v != "" {
+			return redacted
+		}
+		if key == "webhook-urls" {
+			return webhook.RedactUrl(v)
+		}
+		if strings.HasSuffix(key, "-url") || strings.HasSuffix(key, "-urls") {
+			return redactUrl(v)
+		}
+	}
+	return value
+}
+
+// configValue converts v to a value that encodes like the configuration it was decoded from.
+func configValue(v reflect.Value) interface{} {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return configValue(v.Elem())
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			key := fieldKey(field)
+			if field.PkgPath != "" || key == "-" {
+				continue
+			}
+			m[key] = configValue(v.Field(i))
+		}
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = configValue(v.Index(i))
+		}
+		return s
+	case reflect.Map:
+		m := make(map[string]interface{})
+		for _, key := range v.MapKeys() {
+			m[fmt.Sprint(key.Interface())] = configValue(v.MapIndex(key))
+		}
+		return m
+	default:
+		return v.Interface()
+	}
+}
+
+// redactUrl redacts the password of a URL.
+func redactUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.User == nil {
+		return rawUrl
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
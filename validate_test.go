@@ -0,0 +1,190 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func TestRoutes(t *testing.T) {
+	valid := Config{
+		HealthPath:      "/health",
+		LivenessPath:    "/healthz",
+		MetricsPath:     "/metrics",
+		MaintenancePath: "/maintenance",
+		HistoryPath:     "/health/history",
+		HistoryFile:     "history.db",
+		SloPath:         "/health/slo",
+		EventsPath:      "/health/events",
+	}
+	tests := []struct {
+		name     string
+		modify   func(config *Config)
+		problems []string
+	}{
+		{"defaults", func(config *Config) {}, nil},
+		{"trailing slashes", func(config *Config) {
+			config.HealthPath = "/health/"
+			config.MaintenancePath = "/maintenance/"
+		}, nil},
+		{"same path", func(config *Config) {
+			config.MetricsPath = "/healthz"
+		}, []string{`path "/healthz" is already used by liveness-path`}},
+		{"subtree of health path", func(config *Config) {
+			config.EventsPath = "/health/"
+		}, []string{`path "/health/" is already used by health-path`}},
+		{"maintenance at health path", func(config *Config) {
+			config.MaintenancePath = "/health"
+		}, []string{`path "/health" is already used by maintenance-path`}},
+		{"history disabled", func(config *Config) {
+			config.HistoryFile = ""
+			config.SloPath = "/metrics"
+		}, nil},
+		{"history enabled", func(config *Config) {
+			config.SloPath = "/metrics"
+		}, []string{`path "/metrics" is already used by metrics-path`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := valid
+			test.modify(&config)
+			v := &validator{}
+			v.routes(&config)
+			if len(v.problems) != len(test.problems) {
+				t.Fatalf("expected %d problems, got %v", len(test.problems), v.problems)
+			}
+			for i, p := range v.problems {
+				if p.message != test.problems[i] {
+					t.Errorf("expected %q, got %q", test.problems[i], p.message)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactWebhookUrl(t *testing.T) {
+	v := &validator{}
+	v.url("webhook-urls", "ftp://example.org/secret")
+	v.url("webhook-urls", "https://exa mple.org/secret")
+	for _, p := range v.problems {
+		if strings.Contains(p.message, "secret") {
+			t.Errorf("expected webhook URL to be redacted: %s", p.message)
+		}
+	}
+	if len(v.problems) != 2 {
+		t.Errorf("expected 2 problems, got %v", v.problems)
+	}
+}
+
+func TestValidateConfigSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+
+	// the flags are defined by main, so the flag used here is defined if needed
+	if flag.Lookup("check-interval") == nil {
+		flag.Duration("check-interval", time.Minute, "")
+	}
+	checkInterval := flag.Lookup("check-interval")
+
+	tests := []struct {
+		name    string
+		extra   string
+		env     map[string]string
+		flags   map[string]string
+		key     string
+		source  string
+		message string
+	}{
+		{name: "valid"},
+		{
+			name:    "unknown key in file",
+			extra:   "check-intervall: 1m\n",
+			key:     "check-intervall",
+			source:  "file " + file,
+			message: "unknown key",
+		},
+		{
+			name:    "invalid value in file",
+			extra:   "crawl-log-window: soon\n",
+			key:     "crawl-log-window",
+			source:  "file " + file,
+			message: "soon",
+		},
+		{
+			name:    "invalid value in env",
+			env:     map[string]string{"CRAWL_LOG_MAX_ENTRIES": "many"},
+			key:     "crawl-log-max-entries",
+			source:  "env CRAWL_LOG_MAX_ENTRIES",
+			message: "many",
+		},
+		{
+			// the environment variable overrides the valid value in the file
+			name:    "invalid value in env overriding file",
+			extra:   "slo-target: 99.9\n",
+			env:     map[string]string{"SLO_TARGET": "200"},
+			key:     "slo-target",
+			source:  "env SLO_TARGET",
+			message: "200",
+		},
+		{
+			name:    "invalid value in flag",
+			env:     map[string]string{"CHECK_INTERVAL": "1m"},
+			flags:   map[string]string{"check-interval": "-1s"},
+			key:     "check-interval",
+			source:  "flag --check-interval",
+			message: "-1s",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer viper.Reset()
+			writeConfig(t, file, "http://localhost:9090", test.extra)
+			useConfig(t, file)
+			viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+			viper.AutomaticEnv()
+			for name, value := range test.env {
+				if err := os.Setenv(name, value); err != nil {
+					t.Fatal(err)
+				}
+				defer os.Unsetenv(name)
+			}
+			for name, value := range test.flags {
+				if err := flag.Set(name, value); err != nil {
+					t.Fatal(err)
+				}
+				if err := viper.BindPFlag(name, flag.Lookup(name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			defer func() {
+				_ = checkInterval.Value.Set(checkInterval.DefValue)
+				checkInterval.Changed = false
+			}()
+
+			_, problems := validateConfig()
+			if test.key == "" {
+				if len(problems) > 0 {
+					t.Errorf("unexpected problems: %v", problems)
+				}
+				return
+			}
+			if len(problems) != 1 {
+				t.Fatalf("expected 1 problem, got %v", problems)
+			}
+			p := problems[0]
+			if p.key != test.key || p.source != test.source || !strings.Contains(p.message, test.message) {
+				t.Errorf("expected problem with %s (%s) mentioning %q, got %s", test.key, test.source, test.message, p)
+			}
+		})
+	}
+}